@@ -0,0 +1,196 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+var (
+	ErrBMPFormat      = errors.New("malformed BMP")
+	ErrBMPUnsupported = errors.New("unsupported BMP")
+)
+
+// BMP compression methods
+const (
+	bmpRGB            = 0
+	bmpBitFields      = 3
+	bmpAlphaBitFields = 6
+)
+
+// Sizes of the BMP file header and of the smallest info header, the OS/2
+// one
+const (
+	bmpFileHeaderSize = 14
+	bmpCoreHeaderSize = 12
+	bmpInfoHeaderSize = 40
+)
+
+// DecodeBMP reads an uncompressed BMP image from r, with 1, 4 or 8 bit
+// palette indices, or 16, 24 or 32 bit colors, whose channels can be laid
+// out by bit masks. Images stored top-down, with a negative height, are
+// turned bottom-up. The image has an alpha channel if the file has an alpha
+// mask.
+func DecodeBMP(r io.Reader) (Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Image{}, err
+	}
+
+	// A BMP files always begins with "BM"
+	if len(data) < bmpFileHeaderSize+4 || string(data[:2]) != "BM" {
+		return Image{}, fmt.Errorf("%w: no BM signature", ErrBMPFormat)
+	}
+	dataPos := int(binary.LittleEndian.Uint32(data[10:14]))
+	infoSize := int(binary.LittleEndian.Uint32(data[14:18]))
+	if infoSize < bmpCoreHeaderSize || len(data) < bmpFileHeaderSize+infoSize {
+		return Image{}, fmt.Errorf("%w: truncated header", ErrBMPFormat)
+	}
+	info := data[bmpFileHeaderSize : bmpFileHeaderSize+infoSize]
+
+	// Read the information about the image
+	var width, height, bitCount, compression, colorsUsed int
+	paletteEntrySize := 4
+	if infoSize == bmpCoreHeaderSize {
+		width = int(binary.LittleEndian.Uint16(info[4:6]))
+		height = int(binary.LittleEndian.Uint16(info[6:8]))
+		bitCount = int(binary.LittleEndian.Uint16(info[10:12]))
+		paletteEntrySize = 3
+	} else if infoSize >= bmpInfoHeaderSize {
+		width = int(int32(binary.LittleEndian.Uint32(info[4:8])))
+		height = int(int32(binary.LittleEndian.Uint32(info[8:12])))
+		bitCount = int(binary.LittleEndian.Uint16(info[14:16]))
+		compression = int(binary.LittleEndian.Uint32(info[16:20]))
+		colorsUsed = int(binary.LittleEndian.Uint32(info[32:36]))
+	} else {
+		return Image{}, fmt.Errorf("%w: %d byte info header", ErrBMPUnsupported, infoSize)
+	}
+	// Negative heights mean the first row is the top one
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+	if width <= 0 || height == 0 {
+		return Image{}, fmt.Errorf("%w: %dx%d image", ErrBMPFormat, width, height)
+	}
+	rest := data[bmpFileHeaderSize+infoSize:]
+
+	// Channel masks, which follow the info header when it doesn't have them
+	var masks [4]uint32
+	switch compression {
+	case bmpRGB:
+		switch bitCount {
+		case 16:
+			masks = [4]uint32{0x7c00, 0x03e0, 0x001f, 0}
+		case 32:
+			masks = [4]uint32{0xff0000, 0x00ff00, 0x0000ff, 0}
+		}
+	case bmpBitFields, bmpAlphaBitFields:
+		if bitCount != 16 && bitCount != 32 {
+			return Image{}, fmt.Errorf("%w: bit fields with %d bits per pixel", ErrBMPFormat, bitCount)
+		}
+		count := 3
+		if compression == bmpAlphaBitFields || infoSize > 52 {
+			count = 4
+		}
+		source := info[bmpInfoHeaderSize:]
+		if infoSize == bmpInfoHeaderSize {
+			if len(rest) < 4*count {
+				return Image{}, fmt.Errorf("%w: truncated bit fields", ErrBMPFormat)
+			}
+			source, rest = rest, rest[4*count:]
+		}
+		for i := 0; i < count && 4*i+4 <= len(source); i++ {
+			masks[i] = binary.LittleEndian.Uint32(source[4*i:])
+		}
+	default:
+		return Image{}, fmt.Errorf("%w: compression %d", ErrBMPUnsupported, compression)
+	}
+
+	img := Image{Width: width, Height: height, Format: PixelRGB8}
+	var palette []byte
+	switch bitCount {
+	case 1, 4, 8:
+		// Palette of BGR or BGRX entries
+		count := colorsUsed
+		if count == 0 || count > 1<<bitCount {
+			count = 1 << bitCount
+		}
+		count = min(count, len(rest)/paletteEntrySize)
+		palette = make([]byte, 3*count)
+		for i := 0; i < count; i++ {
+			entry := rest[i*paletteEntrySize:]
+			palette[3*i], palette[3*i+1], palette[3*i+2] = entry[2], entry[1], entry[0]
+		}
+		rest = rest[count*paletteEntrySize:]
+	case 16, 24, 32:
+		if masks[3] != 0 {
+			img.Format = PixelRGBA8
+		}
+	default:
+		return Image{}, fmt.Errorf("%w: %d bits per pixel", ErrBMPUnsupported, bitCount)
+	}
+
+	// Some writers leave the offset of the pixels 0, they then follow the
+	// headers, masks and palette
+	if dataPos == 0 {
+		dataPos = len(data) - len(rest)
+	}
+
+	// Rows are padded to 4 bytes. The size of the pixels isn't multiplied
+	// out, since huge dimensions would overflow it.
+	stride := (width*bitCount + 31) / 32 * 4
+	if dataPos > len(data) || height > (len(data)-dataPos)/stride {
+		return Image{}, fmt.Errorf("%w: truncated pixel data", ErrBMPFormat)
+	}
+	pixels := data[dataPos:]
+
+	outSize := img.Format.BytesPerPixel()
+	img.Pix = make([]byte, width*height*outSize)
+	for y := 0; y < height; y++ {
+		row := pixels[y*stride : (y+1)*stride]
+		outY := y
+		if topDown {
+			outY = height - 1 - y
+		}
+		out := img.Pix[outY*width*outSize:]
+		for x := 0; x < width; x++ {
+			dst := out[x*outSize : (x+1)*outSize]
+			switch bitCount {
+			case 1, 4, 8:
+				// Indices are packed from the high bits of each byte
+				bit := x * bitCount
+				index := int(row[bit/8]>>(8-bitCount-bit%8)) & (1<<bitCount - 1)
+				if 3*index >= len(palette) {
+					return Image{}, fmt.Errorf("%w: palette index %d out of range", ErrBMPFormat, index)
+				}
+				copy(dst, palette[3*index:3*index+3])
+			case 24:
+				dst[0], dst[1], dst[2] = row[3*x+2], row[3*x+1], row[3*x]
+			case 16:
+				v := uint32(binary.LittleEndian.Uint16(row[2*x:]))
+				for i := range dst {
+					dst[i] = maskedChannel(v, masks[i])
+				}
+			case 32:
+				v := binary.LittleEndian.Uint32(row[4*x:])
+				for i := range dst {
+					dst[i] = maskedChannel(v, masks[i])
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// maskedChannel extracts the bits of v selected by mask, scaled to a byte.
+func maskedChannel(v, mask uint32) byte {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	maximum := uint64(mask >> shift)
+	return byte(uint64((v&mask)>>shift) * 255 / maximum)
+}
@@ -0,0 +1,111 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// pixelAt returns the pixel of img at x, y, counting rows from the bottom.
+func pixelAt(img Image, x, y int) []byte {
+	size := img.Format.BytesPerPixel()
+	i := (y*img.Width + x) * size
+	return img.Pix[i : i+size]
+}
+
+func TestDecodeBMPAsset(t *testing.T) {
+	f, err := os.Open("../tutorial05/uvtemplate.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := DecodeBMP(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 512 || img.Height != 512 || img.Format != PixelRGB8 || len(img.Pix) != 512*512*3 {
+		t.Fatalf("got %dx%d format %d with %d bytes", img.Width, img.Height, img.Format, len(img.Pix))
+	}
+	for _, p := range []struct {
+		x, y int
+		rgb  []byte
+	}{
+		{0, 0, []byte{132, 131, 155}},
+		{511, 0, []byte{203, 201, 130}},
+		{0, 511, []byte{6, 0, 93}},
+		{511, 511, []byte{70, 69, 2}},
+		{300, 200, []byte{65, 7, 2}},
+	} {
+		if got := pixelAt(img, p.x, p.y); !bytes.Equal(got, p.rgb) {
+			t.Errorf("pixel %d, %d is %v, want %v", p.x, p.y, got, p.rgb)
+		}
+	}
+}
+
+func TestDecodeBMPNoDataOffset(t *testing.T) {
+	data, err := os.ReadFile("../tutorial05/uvtemplate.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeBMP(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(data[10:], 0)
+	got, err := DecodeBMP(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("pixels differ without data offset")
+	}
+
+	// A 2x1 image of 1 bit indices, whose pixels follow a palette of two
+	// entries, black and red
+	file := make([]byte, 0, 66)
+	file = append(file, "BM"...)
+	file = binary.LittleEndian.AppendUint32(file, 62+4)
+	file = binary.LittleEndian.AppendUint32(file, 0)
+	file = binary.LittleEndian.AppendUint32(file, 0)
+	info := make([]byte, bmpInfoHeaderSize)
+	binary.LittleEndian.PutUint32(info[0:], bmpInfoHeaderSize)
+	binary.LittleEndian.PutUint32(info[4:], 2)
+	binary.LittleEndian.PutUint32(info[8:], 1)
+	binary.LittleEndian.PutUint16(info[12:], 1)
+	binary.LittleEndian.PutUint16(info[14:], 1)
+	file = append(file, info...)
+	file = append(file, 0, 0, 0, 0, 0, 0, 255, 0)
+	file = append(file, 0x40, 0, 0, 0)
+	img, err := DecodeBMP(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 0, 0, 255, 0, 0}; !bytes.Equal(img.Pix, want) {
+		t.Errorf("palette image pixels %v, want %v", img.Pix, want)
+	}
+}
+
+// TestDecodeBMPHugeDimensions checks that dimensions whose pixels would
+// overflow an int are rejected as truncated rather than allocated.
+func TestDecodeBMPHugeDimensions(t *testing.T) {
+	for _, height := range []int32{0x7fffffff, -0x80000000} {
+		file := make([]byte, 0, bmpFileHeaderSize+bmpInfoHeaderSize)
+		file = append(file, "BM"...)
+		file = binary.LittleEndian.AppendUint32(file, bmpFileHeaderSize+bmpInfoHeaderSize)
+		file = binary.LittleEndian.AppendUint32(file, 0)
+		file = binary.LittleEndian.AppendUint32(file, bmpFileHeaderSize+bmpInfoHeaderSize)
+		info := make([]byte, bmpInfoHeaderSize)
+		binary.LittleEndian.PutUint32(info[0:], bmpInfoHeaderSize)
+		binary.LittleEndian.PutUint32(info[4:], 0x7fffffff)
+		binary.LittleEndian.PutUint32(info[8:], uint32(height))
+		binary.LittleEndian.PutUint16(info[12:], 1)
+		binary.LittleEndian.PutUint16(info[14:], 32)
+		file = append(file, info...)
+		_, err := DecodeBMP(bytes.NewReader(file))
+		if !errors.Is(err, ErrBMPFormat) {
+			t.Errorf("height %d: got %v, want %v", height, err, ErrBMPFormat)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// AABB is an axis-aligned bounding box. An empty box has Min greater than Max.
+type AABB struct {
+	Min, Max mgl32.Vec3
+}
+
+// Empty reports whether the box contains no point.
+func (b AABB) Empty() bool {
+	return b.Min[0] > b.Max[0] || b.Min[1] > b.Max[1] || b.Min[2] > b.Max[2]
+}
+
+// Center returns the middle of the box.
+func (b AABB) Center() mgl32.Vec3 {
+	return b.Min.Add(b.Max).Mul(0.5)
+}
+
+// Size returns the extent of the box along each axis.
+func (b AABB) Size() mgl32.Vec3 {
+	return b.Max.Sub(b.Min)
+}
+
+// BoundingSphere is a sphere containing every point of a mesh.
+type BoundingSphere struct {
+	Center mgl32.Vec3
+	Radius float32
+}
+
+// ComputeAABB returns the bounding box of points, skipping those that aren't
+// numbers. It is empty if no point is left.
+func ComputeAABB(points []mgl32.Vec3) AABB {
+	inf := float32(math.Inf(1))
+	b := AABB{Min: mgl32.Vec3{inf, inf, inf}, Max: mgl32.Vec3{-inf, -inf, -inf}}
+	for _, p := range points {
+		if !isFinite(p) {
+			continue
+		}
+		for i := range p {
+			b.Min[i] = min(b.Min[i], p[i])
+			b.Max[i] = max(b.Max[i], p[i])
+		}
+	}
+	return b
+}
+
+// ComputeBoundingSphere returns a sphere containing points, skipping those that
+// aren't numbers. It uses Ritter's algorithm, which gives a sphere at most a
+// few percent larger than the smallest one, or the sphere around the bounding
+// box when that is smaller.
+func ComputeBoundingSphere(points []mgl32.Vec3) BoundingSphere {
+	box := ComputeAABB(points)
+	if box.Empty() {
+		return BoundingSphere{}
+	}
+
+	// Sphere around the bounding box, shrunk to the farthest point
+	boxSphere := BoundingSphere{Center: box.Center()}
+	for _, p := range points {
+		if isFinite(p) {
+			boxSphere.Radius = max(boxSphere.Radius, p.Sub(boxSphere.Center).Len())
+		}
+	}
+
+	// Ritter : start from two far apart points and grow to include the others
+	farthest := func(from mgl32.Vec3) mgl32.Vec3 {
+		best, bestDistance := from, float32(-1)
+		for _, p := range points {
+			if d := p.Sub(from).LenSqr(); isFinite(p) && d > bestDistance {
+				best, bestDistance = p, d
+			}
+		}
+		return best
+	}
+	a := farthest(box.Min)
+	b := farthest(a)
+	sphere := BoundingSphere{Center: a.Add(b).Mul(0.5), Radius: b.Sub(a).Len() / 2}
+	for _, p := range points {
+		if !isFinite(p) {
+			continue
+		}
+		if d := p.Sub(sphere.Center).Len(); d > sphere.Radius {
+			// Move the center towards p just enough for the sphere to reach it
+			newRadius := (sphere.Radius + d) / 2
+			sphere.Center = sphere.Center.Add(p.Sub(sphere.Center).Mul((newRadius - sphere.Radius) / d))
+			sphere.Radius = newRadius
+		}
+	}
+	// Make up for rounding errors in the moves
+	for _, p := range points {
+		if isFinite(p) {
+			sphere.Radius = max(sphere.Radius, p.Sub(sphere.Center).Len())
+		}
+	}
+
+	if boxSphere.Radius < sphere.Radius {
+		return boxSphere
+	}
+	return sphere
+}
+
+// Bounds returns the bounding box of the vertices of m.
+func (m *Mesh) Bounds() AABB {
+	return ComputeAABB(m.Vertices)
+}
+
+// BoundingSphere returns a sphere containing the vertices of m.
+func (m *Mesh) BoundingSphere() BoundingSphere {
+	return ComputeBoundingSphere(m.Vertices)
+}
+
+func isFinite(p mgl32.Vec3) bool {
+	for _, f := range p {
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"testing"
+)
+
+func TestComputeAABB(t *testing.T) {
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	b := ComputeAABB([]mgl32.Vec3{{1, -2, 3}, {nan, 9, 9}, {-1, 0, inf}, {0, 2, -3}})
+	if want := (AABB{Min: mgl32.Vec3{0, -2, -3}, Max: mgl32.Vec3{1, 2, 3}}); b != want {
+		t.Errorf("got %v, want %v", b, want)
+	}
+	if b.Center() != (mgl32.Vec3{0.5, 0, 0}) || b.Size() != (mgl32.Vec3{1, 4, 6}) {
+		t.Errorf("center %v and size %v", b.Center(), b.Size())
+	}
+	for _, points := range [][]mgl32.Vec3{nil, {{nan, 0, 0}}} {
+		if b := ComputeAABB(points); !b.Empty() {
+			t.Errorf("%v: got %v, want an empty box", points, b)
+		}
+	}
+}
+
+func TestComputeBoundingSphere(t *testing.T) {
+	suzanne, err := LoadOBJFile(suzannePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box := suzanne.Bounds()
+	if want := (AABB{Min: mgl32.Vec3{-1.367188, -0.984375, -0.851563}, Max: mgl32.Vec3{1.367188, 0.984375, 0.851563}}); !near(box.Min[:], want.Min[:]) || !near(box.Max[:], want.Max[:]) {
+		t.Errorf("suzanne: got box %v, want %v", box, want)
+	}
+
+	cube := []mgl32.Vec3{{-1, -1, -1}, {1, -1, -1}, {1, 1, -1}, {-1, 1, -1}, {-1, -1, 1}, {1, -1, 1}, {1, 1, 1}, {-1, 1, 1}}
+	for _, tc := range []struct {
+		name   string
+		points []mgl32.Vec3
+		sphere BoundingSphere
+	}{
+		{"suzanne", suzanne.Vertices, BoundingSphere{Radius: 1.4857112}},
+		{"cube", cube, BoundingSphere{Radius: float32(math.Sqrt(3))}},
+		{"segment", []mgl32.Vec3{{1, 0, 0}, {3, 0, 0}, {2, 0.5, 0}, {float32(math.NaN()), 0, 0}}, BoundingSphere{Center: mgl32.Vec3{2, 0, 0}, Radius: 1}},
+		{"point", []mgl32.Vec3{{1, 2, 3}}, BoundingSphere{Center: mgl32.Vec3{1, 2, 3}}},
+		{"empty", nil, BoundingSphere{}},
+	} {
+		sphere := ComputeBoundingSphere(tc.points)
+		if !near(sphere.Center[:], tc.sphere.Center[:]) || math.Abs(float64(sphere.Radius-tc.sphere.Radius)) > 1e-4 {
+			t.Errorf("%s: got %+v, want %+v", tc.name, sphere, tc.sphere)
+		}
+		for _, p := range tc.points {
+			if isFinite(p) && p.Sub(sphere.Center).Len() > sphere.Radius {
+				t.Errorf("%s: %v is outside %+v", tc.name, p, sphere)
+			}
+		}
+	}
+}
+
+func TestFrameSphere(t *testing.T) {
+	savedPosition, savedNear, savedFar, savedSpeed := position, NearPlane, FarPlane, speed
+	defer func() {
+		position, NearPlane, FarPlane, speed = savedPosition, savedNear, savedFar, savedSpeed
+	}()
+
+	for _, tc := range []struct {
+		sphere BoundingSphere
+		// Distance from the center that fits the sphere in the 45° vertical
+		// field of view, radius / sin(22.5°)
+		distance float32
+		speed    float64
+	}{
+		{BoundingSphere{Radius: 1.4857112}, 3.88235, 2.9714224},
+		{BoundingSphere{Center: mgl32.Vec3{1, 2, 3}, Radius: 10}, 26.13126, 20},
+		// A single point is framed as if it were a unit sphere
+		{BoundingSphere{Center: mgl32.Vec3{1, 2, 3}}, 2.61313, 2},
+	} {
+		FrameSphere(tc.sphere)
+		radius := tc.sphere.Radius
+		if radius <= 0 {
+			radius = 1
+		}
+		if want := tc.sphere.Center.Add(mgl32.Vec3{0, 0, tc.distance}); !near(position[:], want[:]) {
+			t.Errorf("%+v: camera at %v, want %v", tc.sphere, position, want)
+		}
+		wantNear, wantFar := (tc.distance-radius)/10, (tc.distance+radius)*10
+		if math.Abs(float64(NearPlane-wantNear)) > 1e-4 || math.Abs(float64(FarPlane-wantFar)) > 1e-3 || math.Abs(speed-tc.speed) > 1e-4 {
+			t.Errorf("%+v: near %v, far %v and speed %v, want %v, %v and %v", tc.sphere, NearPlane, FarPlane, speed, wantNear, wantFar, tc.speed)
+		}
+		// The whole sphere lies between the clipping planes
+		if NearPlane <= 0 || tc.distance-radius < NearPlane || tc.distance+radius > FarPlane {
+			t.Errorf("%+v: clipped by planes at %v and %v", tc.sphere, NearPlane, FarPlane)
+		}
+	}
+}
@@ -11,6 +11,9 @@ var once sync.Once
 var lastTime float64
 
 var ViewMatrix, ProjectionMatrix mgl32.Mat4
+
+// NearPlane and FarPlane are the distances the projection matrix clips at.
+var NearPlane, FarPlane float32
 var position mgl32.Vec3
 var horizontalAngle, verticalAngle, initialFoV, speed, mouseSpeed float64
 
@@ -26,6 +29,33 @@ func init() {
 
 	speed = 3.0 // 3 units / second
 	mouseSpeed = 0.005
+
+	// Display range : 0.1 unit <-> 100 units
+	NearPlane = 0.1
+	FarPlane = 100.0
+}
+
+// FrameSphere moves the camera on the +Z side of sphere, looking toward -Z,
+// just far enough for all of it to be in view. The clipping planes and speed
+// are scaled to the size of the sphere so the model stays visible while
+// moving around it.
+func FrameSphere(sphere BoundingSphere) {
+	radius := sphere.Radius
+	if radius <= 0 {
+		radius = 1
+	}
+
+	// The vertical field of view is the narrowest with a 4:3 ratio
+	halfFoV := mgl32.DegToRad(float32(initialFoV)) / 2
+	distance := radius / float32(math.Sin(float64(halfFoV)))
+
+	position = sphere.Center.Add(mgl32.Vec3{0, 0, distance})
+	horizontalAngle = 3.14
+	verticalAngle = 0.0
+
+	NearPlane = (distance - radius) / 10
+	FarPlane = (distance + radius) * 10
+	speed = 2 * float64(radius)
 }
 
 func ComputeMatricesFromInputs(window *glfw.Window) {
@@ -81,8 +111,8 @@ func ComputeMatricesFromInputs(window *glfw.Window) {
 
 	FoV := initialFoV // - 5 * glfwGetMouseWheel(); // Now GLFW 3 requires setting up a callback for this. It's a bit too complicated for this beginner's tutorial, so it's disabled instead.
 
-	// Projection matrix : 45° Field of View, 4:3 ratio, display range : 0.1 unit <-> 100 units
-	ProjectionMatrix = mgl32.Perspective(mgl32.DegToRad(float32(FoV)), float32(1024)/float32(768), 0.1, 100.0)
+	// Projection matrix : 45° Field of View, 4:3 ratio, display range : NearPlane <-> FarPlane
+	ProjectionMatrix = mgl32.Perspective(mgl32.DegToRad(float32(FoV)), float32(1024)/float32(768), NearPlane, FarPlane)
 	// Camera matrix
 	ViewMatrix = mgl32.LookAtV(position, position.Add(direction), up)
 
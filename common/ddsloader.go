@@ -0,0 +1,377 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+var (
+	ErrDDSFormat      = errors.New("malformed DDS")
+	ErrDDSUnsupported = errors.New("unsupported DDS")
+)
+
+const (
+	FOURCC_DXT1 uint32 = uint32(0x31545844)
+	FOURCC_DXT3 uint32 = uint32(0x33545844)
+	FOURCC_DXT5 uint32 = uint32(0x35545844)
+)
+
+// Other FourCCs of block compressed formats. DXT2 and DXT4 are DXT3 and DXT5
+// with premultiplied alpha.
+const (
+	fourCCDXT2 uint32 = 0x32545844
+	fourCCDXT4 uint32 = 0x34545844
+	fourCCATI1 uint32 = 0x31495441
+	fourCCBC4U uint32 = 0x55344342
+	fourCCBC4S uint32 = 0x53344342
+	fourCCATI2 uint32 = 0x32495441
+	fourCCBC5U uint32 = 0x55354342
+	fourCCBC5S uint32 = 0x53354342
+	fourCCDX10 uint32 = 0x30315844
+)
+
+// Flags of the DDS header, of its pixel format and of its second caps field
+const (
+	ddsHeaderDepth       = 0x800000
+	ddsHeaderMipMapCount = 0x20000
+
+	ddsPixelAlphaPixels = 0x1
+	ddsPixelAlpha       = 0x2
+	ddsPixelFourCC      = 0x4
+	ddsPixelRGB         = 0x40
+	ddsPixelLuminance   = 0x20000
+
+	ddsCaps2CubeMap  = 0x200
+	ddsCaps2AllFaces = 0xfc00
+	ddsCaps2Volume   = 0x200000
+
+	ddsDX10CubeMap   = 0x4
+	ddsDX10Texture3D = 4
+)
+
+const (
+	ddsHeaderSize     = 128
+	ddsDX10HeaderSize = 20
+	// ddsMaxSize bounds the dimensions and layer count of images, far
+	// beyond what GPUs support, so that sizes can't overflow
+	ddsMaxSize = 1 << 16
+)
+
+// DDSImage is a decoded DDS file: a 2D texture, cube map, array or volume
+// texture, with its mipmaps. Its pixels are either block compressed or made
+// of bytes like those of an Image.
+type DDSImage struct {
+	Width  int
+	Height int
+	// Depth is the number of slices of volume textures, 1 otherwise.
+	Depth int
+	// Layers is the number of textures of arrays, 1 otherwise.
+	Layers int
+	// Cube tells that each layer is a cube map of six faces.
+	Cube bool
+
+	// Compressed tells whether pixels are in CompressedFormat, or else in
+	// PixelFormat.
+	Compressed       bool
+	CompressedFormat CompressedFormat
+	PixelFormat      PixelFormat
+	SRGB             bool
+
+	// Levels holds the mipmaps, from the full size image down to at most
+	// 1x1, each halving the size of the previous one. Each level holds the
+	// layers in turn, each the faces in +X, -X, +Y, -Y, +Z, -Z order for
+	// cube maps, or the slices of volume textures. Unlike Image, rows start
+	// from the top one, as DDS files store them.
+	Levels [][]byte
+}
+
+// Faces returns the number of faces of each layer, 6 for cube maps and 1
+// otherwise.
+func (d *DDSImage) Faces() int {
+	if d.Cube {
+		return 6
+	}
+	return 1
+}
+
+// LevelSize returns the size of one face or slice of mipmap level.
+func (d *DDSImage) LevelSize(level int) int {
+	width, height := max(d.Width>>level, 1), max(d.Height>>level, 1)
+	if d.Compressed {
+		return d.CompressedFormat.LevelSize(width, height)
+	}
+	return width * height * d.PixelFormat.BytesPerPixel()
+}
+
+// CompressedImage returns d as a CompressedImage sharing its levels, or
+// false unless d is a single block compressed 2D texture.
+func (d *DDSImage) CompressedImage() (CompressedImage, bool) {
+	if !d.Compressed || d.Cube || d.Layers > 1 || d.Depth > 1 {
+		return CompressedImage{}, false
+	}
+	return CompressedImage{Width: d.Width, Height: d.Height, Format: d.CompressedFormat, Levels: d.Levels}, true
+}
+
+// validate checks that d has at least one mipmap level, each of the size of
+// all its layers, faces or slices.
+func (d *DDSImage) validate() error {
+	if d.Width <= 0 || d.Height <= 0 || len(d.Levels) == 0 {
+		return fmt.Errorf("%dx%d image with %d mipmap levels", d.Width, d.Height, len(d.Levels))
+	}
+	for level, data := range d.Levels {
+		surfaces := max(d.Layers, 1) * d.Faces() * max(d.Depth>>level, 1)
+		if size := surfaces * d.LevelSize(level); len(data) != size {
+			return fmt.Errorf("mipmap level %d has %d bytes instead of %d", level, len(data), size)
+		}
+	}
+	return nil
+}
+
+// DecodeDDS reads a DDS file from r. It supports the DXT1 to DXT5 and BC4
+// to BC7 block compressed formats, including those only the DX10 header
+// can describe, and uncompressed RGB, luminance and alpha formats of up to
+// 32 bits, which are converted to 8 bits per channel according to their
+// masks. Cube maps must have all their faces.
+func DecodeDDS(r io.Reader) (DDSImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return DDSImage{}, err
+	}
+
+	// verify the type of file
+	if len(data) < ddsHeaderSize {
+		return DDSImage{}, fmt.Errorf("%w: truncated header", ErrDDSFormat)
+	}
+	if string(data[:4]) != "DDS " {
+		return DDSImage{}, fmt.Errorf("%w: no DDS signature", ErrDDSFormat)
+	}
+
+	// get surface desc
+	field := func(offset int) uint32 {
+		return binary.LittleEndian.Uint32(data[offset:])
+	}
+	flags := field(8)
+	img := DDSImage{
+		Width:  int(field(16)),
+		Height: int(field(12)),
+		Depth:  1,
+		Layers: 1,
+	}
+	mipMapCount := 1
+	if flags&ddsHeaderMipMapCount != 0 {
+		mipMapCount = max(int(field(28)), 1)
+	}
+	pixelFlags := field(80)
+	fourCC := field(84)
+	caps2 := field(112)
+	if caps2&ddsCaps2CubeMap != 0 {
+		if caps2&ddsCaps2AllFaces != ddsCaps2AllFaces {
+			return DDSImage{}, fmt.Errorf("%w: cube map without all its faces", ErrDDSUnsupported)
+		}
+		img.Cube = true
+	}
+	if caps2&ddsCaps2Volume != 0 && flags&ddsHeaderDepth != 0 {
+		img.Depth = max(int(field(24)), 1)
+	}
+	pixels := data[ddsHeaderSize:]
+
+	// How to convert uncompressed pixels, nil for compressed ones
+	var convert func(dst, src []byte)
+	pixelSize := 0
+	switch {
+	case pixelFlags&ddsPixelFourCC != 0 && fourCC == fourCCDX10:
+		if len(pixels) < ddsDX10HeaderSize {
+			return DDSImage{}, fmt.Errorf("%w: truncated DX10 header", ErrDDSFormat)
+		}
+		dx10 := pixels[:ddsDX10HeaderSize]
+		pixels = pixels[ddsDX10HeaderSize:]
+		dxgiFormat := binary.LittleEndian.Uint32(dx10)
+		dimension := binary.LittleEndian.Uint32(dx10[4:])
+		img.Cube = binary.LittleEndian.Uint32(dx10[8:])&ddsDX10CubeMap != 0
+		img.Layers = max(int(binary.LittleEndian.Uint32(dx10[12:])), 1)
+		if dimension != ddsDX10Texture3D {
+			img.Depth = 1
+		}
+		if convert, pixelSize, err = img.setDXGIFormat(dxgiFormat); err != nil {
+			return DDSImage{}, err
+		}
+	case pixelFlags&ddsPixelFourCC != 0:
+		img.Compressed = true
+		switch fourCC {
+		case FOURCC_DXT1:
+			img.CompressedFormat = CompressedDXT1
+		case fourCCDXT2, FOURCC_DXT3:
+			img.CompressedFormat = CompressedDXT3
+		case fourCCDXT4, FOURCC_DXT5:
+			img.CompressedFormat = CompressedDXT5
+		case fourCCATI1, fourCCBC4U:
+			img.CompressedFormat = CompressedBC4
+		case fourCCBC4S:
+			img.CompressedFormat = CompressedBC4Signed
+		case fourCCATI2, fourCCBC5U:
+			img.CompressedFormat = CompressedBC5
+		case fourCCBC5S:
+			img.CompressedFormat = CompressedBC5Signed
+		default:
+			// Small values are Direct3D format numbers rather than text
+			if fourCC < 0x100 {
+				return DDSImage{}, fmt.Errorf("%w: Direct3D format %d", ErrDDSUnsupported, fourCC)
+			}
+			return DDSImage{}, fmt.Errorf("%w: format %q", ErrDDSUnsupported, data[84:88])
+		}
+	case pixelFlags&(ddsPixelRGB|ddsPixelLuminance|ddsPixelAlpha) != 0:
+		bitCount := int(field(88))
+		masks := [4]uint32{field(92), field(96), field(100), field(104)}
+		if pixelFlags&(ddsPixelAlphaPixels|ddsPixelAlpha) == 0 {
+			masks[3] = 0
+		}
+		if convert, err = img.setMaskFormat(pixelFlags, bitCount, masks); err != nil {
+			return DDSImage{}, err
+		}
+		pixelSize = bitCount / 8
+	default:
+		return DDSImage{}, fmt.Errorf("%w: pixel format flags %#x", ErrDDSUnsupported, pixelFlags)
+	}
+	if img.Width == 0 || img.Height == 0 {
+		return DDSImage{}, fmt.Errorf("%w: empty image", ErrDDSFormat)
+	}
+	if max(img.Width, img.Height, img.Depth, img.Layers) > ddsMaxSize {
+		return DDSImage{}, fmt.Errorf("%w: %dx%dx%d image with %d layers", ErrDDSUnsupported, img.Width, img.Height, img.Depth, img.Layers)
+	}
+	if img.Depth > 1 && (img.Cube || img.Layers > 1) {
+		return DDSImage{}, fmt.Errorf("%w: volume texture with several layers", ErrDDSUnsupported)
+	}
+
+	// Files may stop before 1x1, but can't go further
+	fullChain := bits.Len(uint(max(img.Width, img.Height, img.Depth)))
+	mipMapCount = min(mipMapCount, fullChain)
+
+	// Check the size before allocating, then read every mipmap of every
+	// surface, storing them by level
+	surfaces := img.Layers * img.Faces()
+	total := 0
+	for level := 0; level < mipMapCount; level++ {
+		depth := max(img.Depth>>level, 1)
+		if convert != nil {
+			total += surfaces * depth * max(img.Width>>level, 1) * max(img.Height>>level, 1) * pixelSize
+		} else {
+			total += surfaces * depth * img.LevelSize(level)
+		}
+	}
+	if len(pixels) < total {
+		return DDSImage{}, fmt.Errorf("%w: truncated pixel data", ErrDDSFormat)
+	}
+	img.Levels = make([][]byte, mipMapCount)
+	for surface := 0; surface < surfaces; surface++ {
+		for level := range img.Levels {
+			count := max(img.Width>>level, 1) * max(img.Height>>level, 1) * max(img.Depth>>level, 1)
+			size := img.LevelSize(level) * max(img.Depth>>level, 1)
+			if convert == nil {
+				img.Levels[level] = append(img.Levels[level], pixels[:size]...)
+				pixels = pixels[size:]
+				continue
+			}
+			outSize := img.PixelFormat.BytesPerPixel()
+			start := len(img.Levels[level])
+			img.Levels[level] = append(img.Levels[level], make([]byte, size)...)
+			dst := img.Levels[level][start:]
+			for i := 0; i < count; i++ {
+				convert(dst[i*outSize:], pixels[i*pixelSize:])
+			}
+			pixels = pixels[count*pixelSize:]
+		}
+	}
+	return img, nil
+}
+
+// setDXGIFormat sets the format of d from the DXGI format of a DX10 header.
+// It returns how to convert uncompressed pixels and their size.
+func (d *DDSImage) setDXGIFormat(dxgiFormat uint32) (func(dst, src []byte), int, error) {
+	compressed := map[uint32]CompressedFormat{
+		70: CompressedDXT1, 71: CompressedDXT1, 72: CompressedDXT1,
+		73: CompressedDXT3, 74: CompressedDXT3, 75: CompressedDXT3,
+		76: CompressedDXT5, 77: CompressedDXT5, 78: CompressedDXT5,
+		79: CompressedBC4, 80: CompressedBC4, 81: CompressedBC4Signed,
+		82: CompressedBC5, 83: CompressedBC5, 84: CompressedBC5Signed,
+		94: CompressedBC6H, 95: CompressedBC6H, 96: CompressedBC6HSigned,
+		97: CompressedBC7, 98: CompressedBC7, 99: CompressedBC7,
+	}
+	if format, found := compressed[dxgiFormat]; found {
+		d.Compressed = true
+		d.CompressedFormat = format
+		// The sRGB variants
+		d.SRGB = dxgiFormat == 72 || dxgiFormat == 75 || dxgiFormat == 78 || dxgiFormat == 99
+		return nil, 0, nil
+	}
+
+	d.PixelFormat = PixelRGBA8
+	switch dxgiFormat {
+	case 27, 28, 29: // R8G8B8A8
+		d.SRGB = dxgiFormat == 29
+		return func(dst, src []byte) { copy(dst[:4], src) }, 4, nil
+	case 87, 90, 91: // B8G8R8A8
+		d.SRGB = dxgiFormat == 91
+		return func(dst, src []byte) {
+			dst[0], dst[1], dst[2], dst[3] = src[2], src[1], src[0], src[3]
+		}, 4, nil
+	case 88, 92, 93: // B8G8R8X8
+		d.SRGB = dxgiFormat == 93
+		return func(dst, src []byte) {
+			dst[0], dst[1], dst[2], dst[3] = src[2], src[1], src[0], 0xff
+		}, 4, nil
+	case 61, 60: // R8
+		d.PixelFormat = PixelGray8
+		return func(dst, src []byte) { dst[0] = src[0] }, 1, nil
+	}
+	return nil, 0, fmt.Errorf("%w: DXGI format %d", ErrDDSUnsupported, dxgiFormat)
+}
+
+// setMaskFormat sets the format of d from the masks of an uncompressed
+// pixel format. It returns how to convert the pixels.
+func (d *DDSImage) setMaskFormat(pixelFlags uint32, bitCount int, masks [4]uint32) (func(dst, src []byte), error) {
+	if bitCount != 8 && bitCount != 16 && bitCount != 24 && bitCount != 32 {
+		return nil, fmt.Errorf("%w: %d bit pixels", ErrDDSUnsupported, bitCount)
+	}
+	read := func(src []byte) uint32 {
+		var v uint32
+		for i := bitCount/8 - 1; i >= 0; i-- {
+			v = v<<8 | uint32(src[i])
+		}
+		return v
+	}
+
+	switch {
+	case pixelFlags&ddsPixelLuminance != 0 && masks[3] != 0:
+		d.PixelFormat = PixelGrayAlpha8
+		return func(dst, src []byte) {
+			v := read(src)
+			dst[0], dst[1] = maskedChannel(v, masks[0]), maskedChannel(v, masks[3])
+		}, nil
+	case pixelFlags&ddsPixelLuminance != 0:
+		d.PixelFormat = PixelGray8
+		return func(dst, src []byte) {
+			dst[0] = maskedChannel(read(src), masks[0])
+		}, nil
+	case pixelFlags&ddsPixelRGB == 0:
+		// Alpha only, which samples as black
+		d.PixelFormat = PixelRGBA8
+		return func(dst, src []byte) {
+			dst[0], dst[1], dst[2] = 0, 0, 0
+			dst[3] = maskedChannel(read(src), masks[3])
+		}, nil
+	case masks[3] != 0:
+		d.PixelFormat = PixelRGBA8
+	default:
+		d.PixelFormat = PixelRGB8
+	}
+	outSize := d.PixelFormat.BytesPerPixel()
+	return func(dst, src []byte) {
+		v := read(src)
+		for i := 0; i < outSize; i++ {
+			dst[i] = maskedChannel(v, masks[i])
+		}
+	}, nil
+}
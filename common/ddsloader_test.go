@@ -0,0 +1,95 @@
+package common
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// dxtTexel returns the color of texel x, y of a DXT3 or DXT5 block, whose
+// second half is a four color DXT1 block.
+func dxtTexel(block []byte, x, y int) [3]byte {
+	colors := block[8:]
+	var endpoints [2][3]float64
+	for i := range endpoints {
+		c := binary.LittleEndian.Uint16(colors[2*i:])
+		endpoints[i] = [3]float64{float64(c>>11) * 255 / 31, float64(c>>5&63) * 255 / 63, float64(c&31) * 255 / 31}
+	}
+	// Indices 2 and 3 are a third and two thirds of the way to the second
+	weight := [4]float64{0, 1, 1.0 / 3, 2.0 / 3}[colors[4+y]>>(2*x)&3]
+	var texel [3]byte
+	for i := range texel {
+		texel[i] = byte(endpoints[0][i]*(1-weight) + endpoints[1][i]*weight + 0.5)
+	}
+	return texel
+}
+
+func TestDecodeDDSAssets(t *testing.T) {
+	white, black := [3]byte{255, 255, 255}, [3]byte{0, 0, 0}
+	for _, tc := range []struct {
+		path string
+		// Texels of the first block of the 65th row of blocks, from the top
+		texels map[[2]int][3]byte
+	}{
+		{"../tutorial05/uvtemplate.DDS", map[[2]int][3]byte{{0, 0}: black, {2, 0}: white, {0, 3}: black}},
+		{"../tutorial07/uvmap.DDS", map[[2]int][3]byte{{0, 0}: white, {1, 0}: {189, 190, 189}, {3, 3}: white}},
+	} {
+		f, err := os.Open(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := DecodeDDS(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+
+		if img.Width != 512 || img.Height != 512 || img.Depth != 1 || img.Layers != 1 || img.Cube {
+			t.Errorf("%s: %dx%dx%d image with %d layers", tc.path, img.Width, img.Height, img.Depth, img.Layers)
+		}
+		if !img.Compressed || img.CompressedFormat != CompressedDXT3 {
+			t.Errorf("%s: compressed %v in format %d, want DXT3", tc.path, img.Compressed, img.CompressedFormat)
+		}
+		// A full chain, down to 1x1
+		if len(img.Levels) != 10 {
+			t.Fatalf("%s: %d mipmap levels, want 10", tc.path, len(img.Levels))
+		}
+		for level, data := range img.Levels {
+			if len(data) != img.LevelSize(level) {
+				t.Errorf("%s: level %d has %d bytes, want %d", tc.path, level, len(data), img.LevelSize(level))
+			}
+		}
+
+		compressed, ok := img.CompressedImage()
+		if !ok || compressed.Width != 512 || compressed.Height != 512 || compressed.Format != CompressedDXT3 ||
+			len(compressed.Levels) != len(img.Levels) {
+			t.Fatalf("%s: compressed image %dx%d in format %d with %d levels", tc.path, compressed.Width, compressed.Height, compressed.Format, len(compressed.Levels))
+		}
+
+		// Rows of blocks are 128 blocks of 16 bytes
+		block := compressed.Levels[0][64*128*16:]
+		for xy, want := range tc.texels {
+			if got := dxtTexel(block, xy[0], xy[1]); got != want {
+				t.Errorf("%s: texel %d, %d of the block is %v, want %v", tc.path, xy[0], xy[1], got, want)
+			}
+		}
+	}
+}
+
+func TestDDSCompressedImage(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		img  DDSImage
+		ok   bool
+	}{
+		{"2D", DDSImage{Width: 4, Height: 4, Depth: 1, Layers: 1, Compressed: true}, true},
+		{"uncompressed", DDSImage{Width: 4, Height: 4, Depth: 1, Layers: 1, PixelFormat: PixelRGBA8}, false},
+		{"cube map", DDSImage{Width: 4, Height: 4, Depth: 1, Layers: 1, Cube: true, Compressed: true}, false},
+		{"array", DDSImage{Width: 4, Height: 4, Depth: 1, Layers: 2, Compressed: true}, false},
+		{"volume", DDSImage{Width: 4, Height: 4, Depth: 4, Layers: 1, Compressed: true}, false},
+	} {
+		if _, ok := tc.img.CompressedImage(); ok != tc.ok {
+			t.Errorf("%s: got %v, want %v", tc.name, ok, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,978 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"io"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Errors wrapped by GLTFError.
+var (
+	ErrGLTFFormat      = errors.New("malformed glTF")
+	ErrGLTFIndex       = errors.New("reference out of range")
+	ErrGLTFUnsupported = errors.New("unsupported glTF feature")
+)
+
+// GLTFOptions controls how ReadGLTF builds its Model. A nil *GLTFOptions is
+// the same as the zero value.
+type GLTFOptions struct {
+	// Index keeps the mesh indexed, see IndexMesh.
+	Index bool
+	// Normals, if not nil, computes normals for files that have none.
+	Normals *NormalOptions
+	// FlipV converts V texture coordinates. glTF puts V=0 at the top of the
+	// image, so textures stored bottom row first need VFlipOneMinus.
+	FlipV VFlip
+}
+
+// GLTFError reports which part of a glTF file couldn't be read, as a JSON
+// path such as "accessors[3]".
+type GLTFError struct {
+	File string
+	Path string
+	Err  error
+}
+
+func (e *GLTFError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.File, e.Path, e.Err)
+}
+
+func (e *GLTFError) Unwrap() error {
+	return e.Err
+}
+
+// Accessor component types
+const (
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+)
+
+// Primitive modes that produce triangles
+const (
+	gltfTriangles     = 4
+	gltfTriangleStrip = 5
+	gltfTriangleFan   = 6
+)
+
+// The parts of the glTF 2.0 JSON schema the loader uses. encoding/json
+// matches field names regardless of case.
+type gltfDocument struct {
+	Asset struct {
+		Version string
+	}
+	ExtensionsRequired []string
+	Scene              *int
+	Scenes             []struct {
+		Nodes []int
+	}
+	Nodes       []gltfNode
+	Meshes      []gltfMesh
+	Accessors   []gltfAccessor
+	BufferViews []gltfBufferView
+	Buffers     []gltfBuffer
+	Materials   []gltfMaterial
+	Textures    []struct {
+		Source *int
+	}
+	Images []gltfImage
+}
+
+type gltfNode struct {
+	Name        string
+	Children    []int
+	Mesh        *int
+	Matrix      *[16]float32
+	Translation *[3]float32
+	Rotation    *[4]float32
+	Scale       *[3]float32
+}
+
+type gltfMesh struct {
+	Name       string
+	Primitives []struct {
+		Attributes map[string]int
+		Indices    *int
+		Material   *int
+		Mode       *int
+	}
+}
+
+type gltfAccessor struct {
+	BufferView    *int
+	ByteOffset    int
+	ComponentType int
+	Normalized    bool
+	Count         int
+	Type          string
+	Sparse        *struct {
+		Count   int
+		Indices struct {
+			BufferView    int
+			ByteOffset    int
+			ComponentType int
+		}
+		Values struct {
+			BufferView int
+			ByteOffset int
+		}
+	}
+}
+
+type gltfBufferView struct {
+	Buffer     int
+	ByteOffset int
+	ByteLength int
+	ByteStride int
+}
+
+type gltfBuffer struct {
+	URI        string
+	ByteLength int
+}
+
+type gltfTextureInfo struct {
+	Index int
+}
+
+type gltfMaterial struct {
+	Name                 string
+	PbrMetallicRoughness *struct {
+		BaseColorFactor          *[4]float32
+		BaseColorTexture         *gltfTextureInfo
+		MetallicFactor           *float32
+		RoughnessFactor          *float32
+		MetallicRoughnessTexture *gltfTextureInfo
+	}
+	NormalTexture    *gltfTextureInfo
+	OcclusionTexture *gltfTextureInfo
+	EmissiveTexture  *gltfTextureInfo
+	EmissiveFactor   [3]float32
+	AlphaMode        string
+	AlphaCutoff      *float32
+	DoubleSided      bool
+}
+
+type gltfImage struct {
+	URI        string
+	BufferView *int
+}
+
+var gltfTypeComponents = map[string]int{
+	"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT2": 4, "MAT3": 9, "MAT4": 16,
+}
+
+// ReadGLTF parses a glTF 2.0 file from r, either JSON or binary (.glb).
+// External buffers and images are looked up in dir, which may be nil for
+// self-contained files. name is only used in error messages.
+//
+// The meshes of the default scene are put in a single Model with their node
+// transforms applied, one Object per node that has a mesh and one SubMesh
+// per primitive. Points and lines are skipped.
+func ReadGLTF(r io.Reader, name string, dir fs.FS, opts *GLTFOptions) (Model, error) {
+	if opts == nil {
+		opts = &GLTFOptions{}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Model{}, err
+	}
+
+	g := &gltfReader{name: name, dir: dir, opts: opts}
+	if bytes.HasPrefix(data, []byte("glTF")) {
+		if data, err = g.parseGLB(data); err != nil {
+			return Model{}, err
+		}
+	}
+	if err := json.Unmarshal(data, &g.doc); err != nil {
+		return Model{}, g.fail("", fmt.Errorf("%w: %v", ErrGLTFFormat, err))
+	}
+	if !strings.HasPrefix(g.doc.Asset.Version, "2.") {
+		return Model{}, g.fail("asset.version", fmt.Errorf("%w: version %q", ErrGLTFUnsupported, g.doc.Asset.Version))
+	}
+	if len(g.doc.ExtensionsRequired) > 0 {
+		return Model{}, g.fail("extensionsRequired", fmt.Errorf("%w: %s", ErrGLTFUnsupported, strings.Join(g.doc.ExtensionsRequired, ", ")))
+	}
+	g.buffers = make([][]byte, len(g.doc.Buffers))
+
+	if err := g.readMaterials(); err != nil {
+		return Model{}, err
+	}
+
+	// Nodes of the default scene, or every root node if there is no scene
+	var roots []int
+	switch {
+	case g.doc.Scene != nil:
+		if *g.doc.Scene < 0 || *g.doc.Scene >= len(g.doc.Scenes) {
+			return Model{}, g.fail("scene", ErrGLTFIndex)
+		}
+		roots = g.doc.Scenes[*g.doc.Scene].Nodes
+	case len(g.doc.Scenes) > 0:
+		roots = g.doc.Scenes[0].Nodes
+	default:
+		hasParent := make([]bool, len(g.doc.Nodes))
+		for _, node := range g.doc.Nodes {
+			for _, child := range node.Children {
+				if child >= 0 && child < len(hasParent) {
+					hasParent[child] = true
+				}
+			}
+		}
+		for i := range g.doc.Nodes {
+			if !hasParent[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	g.visited = make([]bool, len(g.doc.Nodes))
+	for _, root := range roots {
+		if err := g.addNode(root, -1, mgl32.Ident4()); err != nil {
+			return Model{}, err
+		}
+	}
+	return g.finish(), nil
+}
+
+// gltfReader builds a Model from a parsed glTF document. Attributes missing
+// from some primitives are appended as zeros and dropped in finish if no
+// primitive had them.
+type gltfReader struct {
+	name    string
+	dir     fs.FS
+	opts    *GLTFOptions
+	doc     gltfDocument
+	bin     []byte
+	buffers [][]byte
+	visited []bool
+
+	model                          Model
+	materialNames                  []string
+	hasUvs, hasNormals, hasTangent bool
+}
+
+func (g *gltfReader) fail(path string, err error) error {
+	return &GLTFError{File: g.name, Path: path, Err: err}
+}
+
+// parseGLB returns the JSON chunk of a binary glTF file and keeps its binary
+// chunk, which is the content of the first buffer.
+func (g *gltfReader) parseGLB(data []byte) ([]byte, error) {
+	if len(data) < 20 {
+		return nil, g.fail("", fmt.Errorf("%w: truncated GLB header", ErrGLTFFormat))
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != 2 {
+		return nil, g.fail("", fmt.Errorf("%w: GLB version %d", ErrGLTFUnsupported, version))
+	}
+	if length := binary.LittleEndian.Uint32(data[8:]); uint64(length) <= uint64(len(data)) {
+		data = data[:length]
+	}
+
+	var jsonChunk []byte
+	for offset := 12; offset+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := string(data[offset+4 : offset+8])
+		offset += 8
+		if length < 0 || length > len(data)-offset {
+			return nil, g.fail("", fmt.Errorf("%w: truncated GLB chunk", ErrGLTFFormat))
+		}
+		switch chunkType {
+		case "JSON":
+			if jsonChunk == nil {
+				jsonChunk = data[offset : offset+length]
+			}
+		case "BIN\x00":
+			if g.bin == nil {
+				g.bin = data[offset : offset+length]
+			}
+		}
+		// Chunks are padded to 4 bytes
+		offset += (length + 3) &^ 3
+	}
+	if jsonChunk == nil {
+		return nil, g.fail("", fmt.Errorf("%w: GLB without JSON chunk", ErrGLTFFormat))
+	}
+	return jsonChunk, nil
+}
+
+// readURI returns the content of a data URI or of a file relative to the
+// glTF file.
+func (g *gltfReader) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		comma := strings.IndexByte(uri, ',')
+		if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+			return nil, fmt.Errorf("%w: data URI isn't base64", ErrGLTFUnsupported)
+		}
+		return base64.StdEncoding.DecodeString(uri[comma+1:])
+	}
+	if g.dir == nil {
+		return nil, fmt.Errorf("%w: external file %q", ErrGLTFUnsupported, uri)
+	}
+	name, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(g.dir, path.Clean(name))
+}
+
+// buffer loads buffer i the first time it is used.
+func (g *gltfReader) buffer(i int) ([]byte, error) {
+	p := fmt.Sprintf("buffers[%d]", i)
+	if i < 0 || i >= len(g.buffers) {
+		return nil, g.fail(p, ErrGLTFIndex)
+	}
+	if g.buffers[i] != nil {
+		return g.buffers[i], nil
+	}
+
+	b := &g.doc.Buffers[i]
+	var data []byte
+	if b.URI == "" {
+		if i != 0 || g.bin == nil {
+			return nil, g.fail(p, fmt.Errorf("%w: buffer without URI", ErrGLTFFormat))
+		}
+		data = g.bin
+	} else {
+		var err error
+		if data, err = g.readURI(b.URI); err != nil {
+			return nil, g.fail(p, err)
+		}
+	}
+	if len(data) < b.ByteLength {
+		return nil, g.fail(p, fmt.Errorf("%w: %d bytes instead of %d", ErrGLTFFormat, len(data), b.ByteLength))
+	}
+	g.buffers[i] = data[:b.ByteLength]
+	return g.buffers[i], nil
+}
+
+// view returns the bytes of buffer view i from offset on, after checking that
+// count elements of elementSize bytes fit in it, along with their stride.
+func (g *gltfReader) view(i, offset, count, elementSize int) ([]byte, int, error) {
+	p := fmt.Sprintf("bufferViews[%d]", i)
+	if i < 0 || i >= len(g.doc.BufferViews) {
+		return nil, 0, g.fail(p, ErrGLTFIndex)
+	}
+	v := &g.doc.BufferViews[i]
+	buffer, err := g.buffer(v.Buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if v.ByteOffset < 0 || v.ByteLength < 0 || v.ByteOffset > len(buffer)-v.ByteLength {
+		return nil, 0, g.fail(p, fmt.Errorf("%w: view outside of its buffer", ErrGLTFFormat))
+	}
+	data := buffer[v.ByteOffset : v.ByteOffset+v.ByteLength]
+
+	stride := elementSize
+	if v.ByteStride > 0 {
+		stride = v.ByteStride
+	}
+	// Sizes come from the file, so they are divided rather than multiplied
+	if count > 0 && (offset < 0 || elementSize > len(data)-offset ||
+		(count > 1 && count-1 > (len(data)-offset-elementSize)/stride)) {
+		return nil, 0, g.fail(p, fmt.Errorf("%w: accessor outside of its view", ErrGLTFFormat))
+	}
+	return data[offset:], stride, nil
+}
+
+// accessor returns accessor i after checking that it holds elements of type
+// typ, one of the given component types.
+func (g *gltfReader) accessor(i int, typ string, componentTypes ...int) (*gltfAccessor, error) {
+	p := fmt.Sprintf("accessors[%d]", i)
+	if i < 0 || i >= len(g.doc.Accessors) {
+		return nil, g.fail(p, ErrGLTFIndex)
+	}
+	a := &g.doc.Accessors[i]
+	if a.Type != typ {
+		return nil, g.fail(p, fmt.Errorf("%w: %s instead of %s", ErrGLTFFormat, a.Type, typ))
+	}
+	for _, componentType := range componentTypes {
+		if a.ComponentType == componentType {
+			if err := g.checkAccessor(a); err != nil {
+				var gltfErr *GLTFError
+				if !errors.As(err, &gltfErr) {
+					err = g.fail(p, err)
+				}
+				return nil, err
+			}
+			return a, nil
+		}
+	}
+	return nil, g.fail(p, fmt.Errorf("%w: component type %d", ErrGLTFFormat, a.ComponentType))
+}
+
+// maxGLTFImplicitCount bounds the number of elements of accessors without a
+// buffer view, which are zeros the file doesn't need to store.
+const maxGLTFImplicitCount = 1 << 24
+
+// checkAccessor checks that the elements of a fit in its buffer views, so
+// that they can be allocated before being read.
+func (g *gltfReader) checkAccessor(a *gltfAccessor) error {
+	if a.Count < 0 {
+		return ErrGLTFFormat
+	}
+	elementSize := gltfTypeComponents[a.Type] * gltfComponentSize(a.ComponentType)
+	if a.BufferView != nil {
+		if _, _, err := g.view(*a.BufferView, a.ByteOffset, a.Count, elementSize); err != nil {
+			return err
+		}
+	} else if a.Count > maxGLTFImplicitCount {
+		return fmt.Errorf("%w: %d elements without a buffer view", ErrGLTFUnsupported, a.Count)
+	}
+
+	if s := a.Sparse; s != nil {
+		if s.Count < 0 || s.Count > a.Count {
+			return fmt.Errorf("%w: %d sparse elements of %d", ErrGLTFFormat, s.Count, a.Count)
+		}
+		indexSize := gltfComponentSize(s.Indices.ComponentType)
+		if indexSize == 0 || s.Indices.ComponentType == gltfByte || s.Indices.ComponentType == gltfShort {
+			return g.fail("sparse.indices", fmt.Errorf("%w: component type %d", ErrGLTFFormat, s.Indices.ComponentType))
+		}
+		if _, _, err := g.view(s.Indices.BufferView, s.Indices.ByteOffset, s.Count, indexSize); err != nil {
+			return err
+		}
+		if _, _, err := g.view(s.Values.BufferView, s.Values.ByteOffset, s.Count, elementSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAccessor calls read with the bytes of every element of a, in order.
+// Elements of sparse accessors are read again with their replaced value.
+// Accessors without a buffer view are all zeros, and read isn't called. a
+// must have been returned by accessor, which checks its sizes.
+func (g *gltfReader) readAccessor(a *gltfAccessor, read func(element int, b []byte)) error {
+	elementSize := gltfTypeComponents[a.Type] * gltfComponentSize(a.ComponentType)
+	if a.BufferView != nil {
+		data, stride, err := g.view(*a.BufferView, a.ByteOffset, a.Count, elementSize)
+		if err != nil {
+			return err
+		}
+		for e := 0; e < a.Count; e++ {
+			read(e, data[e*stride:])
+		}
+	}
+
+	if s := a.Sparse; s != nil {
+		indexSize := gltfComponentSize(s.Indices.ComponentType)
+		indices, _, err := g.view(s.Indices.BufferView, s.Indices.ByteOffset, s.Count, indexSize)
+		if err != nil {
+			return err
+		}
+		values, _, err := g.view(s.Values.BufferView, s.Values.ByteOffset, s.Count, elementSize)
+		if err != nil {
+			return err
+		}
+		for k := 0; k < s.Count; k++ {
+			e := int(readGLTFIndex(indices[k*indexSize:], s.Indices.ComponentType))
+			if e >= a.Count {
+				return g.fail("sparse.indices", ErrGLTFIndex)
+			}
+			read(e, values[k*elementSize:])
+		}
+	}
+	return nil
+}
+
+// floats reads accessor i, of type typ, as float32s.
+func (g *gltfReader) floats(i int, typ string) ([]float32, error) {
+	a, err := g.accessor(i, typ, gltfFloat, gltfByte, gltfUnsignedByte, gltfShort, gltfUnsignedShort)
+	if err != nil {
+		return nil, err
+	}
+	components := gltfTypeComponents[typ]
+	size := gltfComponentSize(a.ComponentType)
+	values := make([]float32, a.Count*components)
+	err = g.readAccessor(a, func(e int, b []byte) {
+		for c := 0; c < components; c++ {
+			values[e*components+c] = readGLTFComponent(b[c*size:], a.ComponentType, a.Normalized)
+		}
+	})
+	return values, err
+}
+
+// indices reads the index accessor i.
+func (g *gltfReader) indices(i int) ([]uint32, error) {
+	a, err := g.accessor(i, "SCALAR", gltfUnsignedByte, gltfUnsignedShort, gltfUnsignedInt)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]uint32, a.Count)
+	err = g.readAccessor(a, func(e int, b []byte) {
+		indices[e] = readGLTFIndex(b, a.ComponentType)
+	})
+	return indices, err
+}
+
+func gltfComponentSize(componentType int) int {
+	switch componentType {
+	case gltfByte, gltfUnsignedByte:
+		return 1
+	case gltfShort, gltfUnsignedShort:
+		return 2
+	case gltfUnsignedInt, gltfFloat:
+		return 4
+	}
+	return 0
+}
+
+// readGLTFComponent decodes one component, mapping normalized integers to
+// [0, 1] or [-1, 1].
+func readGLTFComponent(b []byte, componentType int, normalized bool) float32 {
+	switch componentType {
+	case gltfByte:
+		v := float32(int8(b[0]))
+		if normalized {
+			return max(v/127, -1)
+		}
+		return v
+	case gltfUnsignedByte:
+		v := float32(b[0])
+		if normalized {
+			return v / 255
+		}
+		return v
+	case gltfShort:
+		v := float32(int16(binary.LittleEndian.Uint16(b)))
+		if normalized {
+			return max(v/32767, -1)
+		}
+		return v
+	case gltfUnsignedShort:
+		v := float32(binary.LittleEndian.Uint16(b))
+		if normalized {
+			return v / 65535
+		}
+		return v
+	}
+	return math.Float32frombits(binary.LittleEndian.Uint32(b))
+}
+
+func readGLTFIndex(b []byte, componentType int) uint32 {
+	switch componentType {
+	case gltfUnsignedByte:
+		return uint32(b[0])
+	case gltfUnsignedShort:
+		return uint32(binary.LittleEndian.Uint16(b))
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+// readMaterials converts every material, naming unnamed or duplicate ones
+// after their index.
+func (g *gltfReader) readMaterials() error {
+	for i := range g.doc.Materials {
+		m := &g.doc.Materials[i]
+		p := fmt.Sprintf("materials[%d]", i)
+
+		name := m.Name
+		if _, taken := g.model.Materials[name]; taken || name == "" {
+			name = fmt.Sprintf("material%d", i)
+		}
+		material := &Material{
+			Name:        name,
+			BaseColor:   mgl32.Vec4{1, 1, 1, 1},
+			Metallic:    1,
+			Roughness:   1,
+			Emissive:    m.EmissiveFactor,
+			AlphaMode:   "OPAQUE",
+			AlphaCutoff: 0.5,
+			DoubleSided: m.DoubleSided,
+		}
+		if m.AlphaMode != "" {
+			material.AlphaMode = m.AlphaMode
+		}
+		if m.AlphaCutoff != nil {
+			material.AlphaCutoff = *m.AlphaCutoff
+		}
+
+		var err error
+		if pbr := m.PbrMetallicRoughness; pbr != nil {
+			if pbr.BaseColorFactor != nil {
+				material.BaseColor = *pbr.BaseColorFactor
+			}
+			if pbr.MetallicFactor != nil {
+				material.Metallic = *pbr.MetallicFactor
+			}
+			if pbr.RoughnessFactor != nil {
+				material.Roughness = *pbr.RoughnessFactor
+			}
+			if material.BaseColorMap, err = g.textureName(pbr.BaseColorTexture); err != nil {
+				return g.fail(p, err)
+			}
+			if material.MetallicRoughnessMap, err = g.textureName(pbr.MetallicRoughnessTexture); err != nil {
+				return g.fail(p, err)
+			}
+		}
+		if material.NormalMap, err = g.textureName(m.NormalTexture); err != nil {
+			return g.fail(p, err)
+		}
+		if material.OcclusionMap, err = g.textureName(m.OcclusionTexture); err != nil {
+			return g.fail(p, err)
+		}
+		if material.EmissiveMap, err = g.textureName(m.EmissiveTexture); err != nil {
+			return g.fail(p, err)
+		}
+
+		// The closest fixed function equivalents
+		material.Diffuse = material.BaseColor.Vec3()
+		material.Dissolve = material.BaseColor[3]
+		material.DiffuseMap = material.BaseColorMap
+		material.Illum = 2
+
+		if g.model.Materials == nil {
+			g.model.Materials = make(map[string]*Material)
+		}
+		g.model.Materials[name] = material
+		g.materialNames = append(g.materialNames, name)
+	}
+	return nil
+}
+
+// textureName returns the name a material uses for the image of a texture:
+// the URI of external images, or a name in Model.Images for embedded ones.
+func (g *gltfReader) textureName(info *gltfTextureInfo) (string, error) {
+	if info == nil {
+		return "", nil
+	}
+	if info.Index < 0 || info.Index >= len(g.doc.Textures) {
+		return "", fmt.Errorf("texture %d: %w", info.Index, ErrGLTFIndex)
+	}
+	source := g.doc.Textures[info.Index].Source
+	if source == nil {
+		// Only provided by an extension
+		return "", nil
+	}
+	if *source < 0 || *source >= len(g.doc.Images) {
+		return "", fmt.Errorf("image %d: %w", *source, ErrGLTFIndex)
+	}
+
+	image := &g.doc.Images[*source]
+	if image.URI != "" && !strings.HasPrefix(image.URI, "data:") {
+		return url.PathUnescape(image.URI)
+	}
+	name := fmt.Sprintf("#image%d", *source)
+	if _, found := g.model.Images[name]; found {
+		return name, nil
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case image.URI != "":
+		data, err = g.readURI(image.URI)
+	case image.BufferView != nil:
+		if *image.BufferView < 0 || *image.BufferView >= len(g.doc.BufferViews) {
+			return "", fmt.Errorf("image %d: %w", *source, ErrGLTFIndex)
+		}
+		data, _, err = g.view(*image.BufferView, 0, 1, g.doc.BufferViews[*image.BufferView].ByteLength)
+	default:
+		err = fmt.Errorf("image %d: %w: no data", *source, ErrGLTFFormat)
+	}
+	if err != nil {
+		return "", err
+	}
+	if g.model.Images == nil {
+		g.model.Images = make(map[string][]byte)
+	}
+	g.model.Images[name] = data
+	return name, nil
+}
+
+// addNode adds node i and its children below the node at index parent in
+// Model.Nodes, whose world transform is parentWorld.
+func (g *gltfReader) addNode(i, parent int, parentWorld mgl32.Mat4) error {
+	p := fmt.Sprintf("nodes[%d]", i)
+	if i < 0 || i >= len(g.doc.Nodes) {
+		return g.fail(p, ErrGLTFIndex)
+	}
+	if g.visited[i] {
+		return g.fail(p, fmt.Errorf("%w: node has several parents", ErrGLTFFormat))
+	}
+	g.visited[i] = true
+	n := &g.doc.Nodes[i]
+
+	local := mgl32.Ident4()
+	if n.Matrix != nil {
+		local = mgl32.Mat4(*n.Matrix)
+	} else {
+		if n.Translation != nil {
+			local = mgl32.Translate3D(n.Translation[0], n.Translation[1], n.Translation[2])
+		}
+		if n.Rotation != nil {
+			r := n.Rotation
+			rotation := mgl32.Quat{W: r[3], V: mgl32.Vec3{r[0], r[1], r[2]}}.Normalize()
+			local = local.Mul4(rotation.Mat4())
+		}
+		if n.Scale != nil {
+			local = local.Mul4(mgl32.Scale3D(n.Scale[0], n.Scale[1], n.Scale[2]))
+		}
+	}
+	world := parentWorld.Mul4(local)
+
+	index := len(g.model.Nodes)
+	g.model.Nodes = append(g.model.Nodes, Node{Name: n.Name, Parent: parent, Local: local, World: world, Object: -1})
+	if n.Mesh != nil {
+		if err := g.addMesh(*n.Mesh, n.Name, world); err != nil {
+			return err
+		}
+		g.model.Nodes[index].Object = len(g.model.Objects) - 1
+	}
+
+	for _, child := range n.Children {
+		if err := g.addNode(child, index, world); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMesh appends mesh i as a new object, transformed by world.
+func (g *gltfReader) addMesh(i int, nodeName string, world mgl32.Mat4) error {
+	p := fmt.Sprintf("meshes[%d]", i)
+	if i < 0 || i >= len(g.doc.Meshes) {
+		return g.fail(p, ErrGLTFIndex)
+	}
+	mesh := &g.doc.Meshes[i]
+
+	name := nodeName
+	if name == "" {
+		name = mesh.Name
+	}
+	// Objects are kept even without triangles so Node.Object stays valid
+	at := len(g.model.Indices)
+	for j := range mesh.Primitives {
+		if err := g.addPrimitive(mesh, j, world); err != nil {
+			var gltfErr *GLTFError
+			if errors.As(err, &gltfErr) && gltfErr.Path == "" {
+				gltfErr.Path = fmt.Sprintf("%s.primitives[%d]", p, j)
+			}
+			return err
+		}
+	}
+	count := len(g.model.Indices) - at
+	g.model.Objects = append(g.model.Objects, Object{
+		Name:   name,
+		First:  at,
+		Count:  count,
+		Groups: []Group{{Name: mesh.Name, First: at, Count: count}},
+	})
+	return nil
+}
+
+// addPrimitive appends the triangles of primitive j of mesh.
+func (g *gltfReader) addPrimitive(mesh *gltfMesh, j int, world mgl32.Mat4) error {
+	primitive := &mesh.Primitives[j]
+	mode := gltfTriangles
+	if primitive.Mode != nil {
+		mode = *primitive.Mode
+	}
+	if mode != gltfTriangles && mode != gltfTriangleStrip && mode != gltfTriangleFan {
+		return nil
+	}
+
+	position, found := primitive.Attributes["POSITION"]
+	if !found {
+		return g.fail("", fmt.Errorf("%w: primitive without POSITION", ErrGLTFFormat))
+	}
+	positions, err := g.floats(position, "VEC3")
+	if err != nil {
+		return err
+	}
+	count := len(positions) / 3
+
+	// Optional attributes, which must have as many elements as positions
+	optional := func(attribute, typ string) ([]float32, error) {
+		i, found := primitive.Attributes[attribute]
+		if !found {
+			return nil, nil
+		}
+		values, err := g.floats(i, typ)
+		if err == nil && len(values) != count*gltfTypeComponents[typ] {
+			err = g.fail(fmt.Sprintf("accessors[%d]", i), fmt.Errorf("%w: %s count differs from POSITION", ErrGLTFFormat, attribute))
+		}
+		return values, err
+	}
+	uvs, err := optional("TEXCOORD_0", "VEC2")
+	if err != nil {
+		return err
+	}
+	normals, err := optional("NORMAL", "VEC3")
+	if err != nil {
+		return err
+	}
+	tangents, err := optional("TANGENT", "VEC4")
+	if err != nil {
+		return err
+	}
+
+	var indices []uint32
+	if primitive.Indices != nil {
+		if indices, err = g.indices(*primitive.Indices); err != nil {
+			return err
+		}
+		for _, index := range indices {
+			if int(index) >= count {
+				return g.fail(fmt.Sprintf("accessors[%d]", *primitive.Indices), ErrGLTFIndex)
+			}
+		}
+	} else {
+		indices = make([]uint32, count)
+		for k := range indices {
+			indices[k] = uint32(k)
+		}
+	}
+	triangles, err := gltfTriangleList(indices, mode)
+	if err != nil {
+		return g.fail("", err)
+	}
+
+	m := &g.model.Mesh
+	material := ""
+	if primitive.Material != nil {
+		if *primitive.Material < 0 || *primitive.Material >= len(g.materialNames) {
+			return g.fail("", fmt.Errorf("material %d: %w", *primitive.Material, ErrGLTFIndex))
+		}
+		material = g.materialNames[*primitive.Material]
+	}
+	m.beginSubMesh(material, len(m.Indices))
+
+	// Mirroring transforms turn the triangles inside out
+	linear := world.Mat3()
+	normalMatrix := linear.Inv().Transpose()
+	mirrored := linear.Det() < 0
+
+	base := uint32(len(m.Vertices))
+	for k := 0; k < count; k++ {
+		p := mgl32.Vec3{positions[3*k], positions[3*k+1], positions[3*k+2]}
+		m.Vertices = append(m.Vertices, world.Mul4x1(p.Vec4(1)).Vec3())
+
+		var uv mgl32.Vec2
+		if uvs != nil {
+			uv = g.opts.FlipV.Apply(mgl32.Vec2{uvs[2*k], uvs[2*k+1]})
+		}
+		m.Uvs = append(m.Uvs, uv)
+
+		var normal mgl32.Vec3
+		if normals != nil {
+			normal = normalize(normalMatrix.Mul3x1(mgl32.Vec3{normals[3*k], normals[3*k+1], normals[3*k+2]}))
+		}
+		m.Normals = append(m.Normals, normal)
+
+		var tangent mgl32.Vec4
+		var bitangent mgl32.Vec3
+		if tangents != nil {
+			t := normalize(linear.Mul3x1(mgl32.Vec3{tangents[4*k], tangents[4*k+1], tangents[4*k+2]}))
+			w := tangents[4*k+3]
+			if mirrored != (g.opts.FlipV != VFlipNone) {
+				w = -w
+			}
+			tangent = t.Vec4(w)
+			bitangent = normal.Cross(t).Mul(w)
+		}
+		m.Tangents = append(m.Tangents, tangent)
+		m.Bitangents = append(m.Bitangents, bitangent)
+	}
+	g.hasUvs = g.hasUvs || uvs != nil
+	g.hasNormals = g.hasNormals || normals != nil
+	g.hasTangent = g.hasTangent || tangents != nil
+
+	for t := 0; t < len(triangles); t += 3 {
+		a, b, c := triangles[t], triangles[t+1], triangles[t+2]
+		if mirrored {
+			b, c = c, b
+		}
+		m.Indices = append(m.Indices, base+a, base+b, base+c)
+		m.Polygons++
+	}
+	return nil
+}
+
+// gltfTriangleList converts the indices of a primitive drawn with mode to a
+// list of triangles.
+func gltfTriangleList(indices []uint32, mode int) ([]uint32, error) {
+	switch mode {
+	case gltfTriangleStrip:
+		var triangles []uint32
+		for i := 0; i+2 < len(indices); i++ {
+			// Every other triangle is wound the other way
+			if i%2 == 0 {
+				triangles = append(triangles, indices[i], indices[i+1], indices[i+2])
+			} else {
+				triangles = append(triangles, indices[i+1], indices[i], indices[i+2])
+			}
+		}
+		return triangles, nil
+	case gltfTriangleFan:
+		var triangles []uint32
+		for i := 1; i+1 < len(indices); i++ {
+			triangles = append(triangles, indices[i], indices[i+1], indices[0])
+		}
+		return triangles, nil
+	}
+	if len(indices)%3 != 0 {
+		return nil, fmt.Errorf("%w: %d indices for a triangle list", ErrGLTFFormat, len(indices))
+	}
+	return indices, nil
+}
+
+// finish closes the open ranges, drops the attributes no primitive had and
+// applies the post-processing options.
+func (g *gltfReader) finish() Model {
+	model := g.model
+	mesh := &model.Mesh
+	mesh.endSubMesh(len(mesh.Indices))
+	if mesh.Indices == nil {
+		// Only vertices of primitives too short for a triangle
+		mesh.clearVertices()
+	}
+
+	if !g.hasUvs {
+		mesh.Uvs = nil
+	}
+	if !g.hasNormals {
+		mesh.Normals = nil
+	}
+	if !g.hasTangent {
+		mesh.Tangents = nil
+		mesh.Bitangents = nil
+	}
+
+	if mesh.Normals == nil && g.opts.Normals != nil {
+		model.Mesh = GenerateNormals(model.Mesh, *g.opts.Normals)
+	}
+	if !g.opts.Index {
+		model.Mesh = UnindexMesh(model.Mesh)
+	}
+	return model
+}
+
+// LoadGLTFFile opens and parses the glTF or GLB file at path. External
+// buffers and images are read relative to it.
+func LoadGLTFFile(path string, opts *GLTFOptions) (Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Model{}, err
+	}
+	defer f.Close()
+
+	return ReadGLTF(f, path, os.DirFS(filepath.Dir(path)), opts)
+}
@@ -0,0 +1,173 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// near tells whether a and b differ by less than 1e-5, which relative
+// comparisons don't do for values close to 0.
+func near(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func vec3sNear(a, b []mgl32.Vec3) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !near(a[i][:], b[i][:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestReadGLTFInterleaved reads a triangle whose positions and uvs share a
+// strided buffer view, drawn by a node with a translation, rotation and
+// scale, and by a mirrored node.
+func TestReadGLTFInterleaved(t *testing.T) {
+	model, err := LoadGLTFFile("testdata/interleaved.gltf", &GLTFOptions{Index: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A quarter turn around Z, then a translation, of a triangle scaled twice
+	wantVertices := []mgl32.Vec3{
+		{1, 2, 3}, {1, 4, 3}, {-1, 2, 3},
+		{0, 0, 0}, {-1, 0, 0}, {0, 1, 0},
+	}
+	if !vec3sNear(model.Vertices, wantVertices) {
+		t.Errorf("vertices %v, want %v", model.Vertices, wantVertices)
+	}
+	wantUvs := []mgl32.Vec2{{0, 0}, {1, 0}, {0, 1}, {0, 0}, {1, 0}, {0, 1}}
+	if !reflect.DeepEqual(model.Uvs, wantUvs) {
+		t.Errorf("uvs %v, want %v", model.Uvs, wantUvs)
+	}
+	// The mirrored triangle is wound the other way to keep facing +Z
+	wantIndices := []uint32{0, 1, 2, 3, 5, 4}
+	if !reflect.DeepEqual(model.Indices, wantIndices) {
+		t.Errorf("indices %v, want %v", model.Indices, wantIndices)
+	}
+	for i := 0; i < model.TriangleCount(); i++ {
+		a, b, c := model.Triangle(i)
+		v := model.Vertices
+		if normal := v[b].Sub(v[a]).Cross(v[c].Sub(v[a])); normal.Z() <= 0 {
+			t.Errorf("triangle %d faces %v", i, normal)
+		}
+	}
+
+	if len(model.Nodes) != 3 {
+		t.Fatalf("%d nodes, want 3", len(model.Nodes))
+	}
+	parent := mgl32.Translate3D(1, 2, 3).Mul4(mgl32.HomogRotate3DZ(mgl32.DegToRad(90))).Mul4(mgl32.Scale3D(2, 2, 2))
+	child := parent.Mul4(mgl32.Translate3D(0, 0, 1))
+	for i, want := range []Node{
+		{Name: "parent", Parent: -1, Local: parent, World: parent, Object: 0},
+		{Name: "child", Parent: 0, Local: mgl32.Translate3D(0, 0, 1), World: child, Object: -1},
+		{Name: "mirrored", Parent: -1, Local: mgl32.Scale3D(-1, 1, 1), World: mgl32.Scale3D(-1, 1, 1), Object: 1},
+	} {
+		got := model.Nodes[i]
+		if got.Name != want.Name || got.Parent != want.Parent || got.Object != want.Object ||
+			!near(got.Local[:], want.Local[:]) || !near(got.World[:], want.World[:]) {
+			t.Errorf("node %d: got %+v, want %+v", i, got, want)
+		}
+	}
+	if len(model.Objects) != 2 || model.Objects[1].Name != "mirrored" || model.Objects[1].First != 3 {
+		t.Errorf("objects %+v", model.Objects)
+	}
+
+	if len(model.SubMeshes) != 1 || model.SubMeshes[0] != (SubMesh{Material: "red", First: 0, Count: 6}) {
+		t.Errorf("sub-meshes %+v", model.SubMeshes)
+	}
+	red := model.Materials["red"]
+	if red == nil {
+		t.Fatal("no red material")
+	}
+	if red.BaseColor != (mgl32.Vec4{1, 0, 0, 0.5}) || red.Metallic != 0.25 || red.Roughness != 0.75 ||
+		red.BaseColorMap != "base color.png" || red.AlphaMode != "BLEND" || !red.DoubleSided {
+		t.Errorf("material %+v", red)
+	}
+}
+
+// TestReadGLTFSparse reads a GLB file whose positions have a sparse
+// replacement and whose uvs are zeros with a sparse replacement.
+func TestReadGLTFSparse(t *testing.T) {
+	model, err := LoadGLTFFile("testdata/sparse.glb", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVertices := []mgl32.Vec3{{0, 0, 0}, {5, 0, 0}, {0, 1, 0}}
+	if !vec3sNear(model.Vertices, wantVertices) {
+		t.Errorf("vertices %v, want %v", model.Vertices, wantVertices)
+	}
+	wantUvs := []mgl32.Vec2{{0, 0}, {0, 0}, {0.5, 0.25}}
+	if !reflect.DeepEqual(model.Uvs, wantUvs) {
+		t.Errorf("uvs %v, want %v", model.Uvs, wantUvs)
+	}
+	if model.Indices != nil || model.Polygons != 1 {
+		t.Errorf("got %d indices and %d polygons, want an unindexed triangle", len(model.Indices), model.Polygons)
+	}
+}
+
+// TestReadGLTFCounts checks that accessor counts too large for their data
+// are rejected before anything is allocated for them.
+func TestReadGLTFCounts(t *testing.T) {
+	data, err := os.ReadFile("testdata/interleaved.gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		edit   func(accessor map[string]any)
+		target error
+	}{
+		{"count past view", func(a map[string]any) { a["count"] = 4000000000 }, ErrGLTFFormat},
+		{"zeros", func(a map[string]any) {
+			delete(a, "bufferView")
+			a["count"] = 4000000000
+		}, ErrGLTFUnsupported},
+		{"sparse count", func(a map[string]any) {
+			a["sparse"] = map[string]any{
+				"count":   4,
+				"indices": map[string]any{"bufferView": 1, "componentType": gltfUnsignedShort},
+				"values":  map[string]any{"bufferView": 0},
+			}
+		}, ErrGLTFFormat},
+		{"sparse past view", func(a map[string]any) {
+			a["sparse"] = map[string]any{
+				"count":   3,
+				"indices": map[string]any{"bufferView": 1, "componentType": gltfUnsignedInt},
+				"values":  map[string]any{"bufferView": 0},
+			}
+		}, ErrGLTFFormat},
+	} {
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		tc.edit(doc["accessors"].([]any)[0].(map[string]any))
+		edited, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ReadGLTF(bytes.NewReader(edited), tc.name, os.DirFS("testdata"), nil)
+		if !errors.Is(err, tc.target) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.target)
+		}
+	}
+}
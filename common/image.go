@@ -0,0 +1,108 @@
+package common
+
+import (
+	"fmt"
+)
+
+// PixelFormat is the layout of the pixels of an Image. Every channel is one
+// byte.
+type PixelFormat int
+
+const (
+	// PixelGray8 is a luminance byte.
+	PixelGray8 PixelFormat = iota
+	// PixelGrayAlpha8 is luminance then alpha.
+	PixelGrayAlpha8
+	// PixelRGB8 is red, green then blue.
+	PixelRGB8
+	// PixelRGBA8 is red, green, blue then alpha.
+	PixelRGBA8
+)
+
+// BytesPerPixel returns the size of one pixel of format f.
+func (f PixelFormat) BytesPerPixel() int {
+	switch f {
+	case PixelGray8:
+		return 1
+	case PixelGrayAlpha8:
+		return 2
+	case PixelRGB8:
+		return 3
+	}
+	return 4
+}
+
+// Image is a decoded texture image.
+type Image struct {
+	Width  int
+	Height int
+	Format PixelFormat
+	// SRGB tells that colors are sRGB encoded, so that they're uploaded as
+	// sRGB textures which shaders sample as linear values.
+	SRGB bool
+	// Pix holds the rows of pixels without padding, starting from the
+	// bottom one, which is where OpenGL puts texture coordinate 0.
+	Pix []byte
+}
+
+// validate checks that img has pixels, as many as its size needs.
+func (img *Image) validate() error {
+	size := img.Width * img.Height * img.Format.BytesPerPixel()
+	if img.Width <= 0 || img.Height <= 0 || len(img.Pix) != size {
+		return fmt.Errorf("%dx%d image with %d bytes of pixels instead of %d", img.Width, img.Height, len(img.Pix), size)
+	}
+	return nil
+}
+
+// CompressedFormat is a block compressed texture format, made of 4x4 pixel
+// blocks.
+type CompressedFormat int
+
+const (
+	// CompressedDXT1 is BC1: RGB with an optional 1 bit alpha, 8 byte blocks.
+	CompressedDXT1 CompressedFormat = iota
+	// CompressedDXT3 is BC2: RGB with explicit 4 bit alpha, 16 byte blocks.
+	CompressedDXT3
+	// CompressedDXT5 is BC3: RGB with interpolated alpha, 16 byte blocks.
+	CompressedDXT5
+	// CompressedBC4 is a single unsigned channel, 8 byte blocks.
+	CompressedBC4
+	// CompressedBC4Signed is a single signed channel, 8 byte blocks.
+	CompressedBC4Signed
+	// CompressedBC5 is two unsigned channels, 16 byte blocks.
+	CompressedBC5
+	// CompressedBC5Signed is two signed channels, 16 byte blocks.
+	CompressedBC5Signed
+	// CompressedBC6H is unsigned half float RGB, 16 byte blocks.
+	CompressedBC6H
+	// CompressedBC6HSigned is signed half float RGB, 16 byte blocks.
+	CompressedBC6HSigned
+	// CompressedBC7 is high quality RGBA, 16 byte blocks.
+	CompressedBC7
+)
+
+// BlockSize returns the size of one 4x4 block of format f.
+func (f CompressedFormat) BlockSize() int {
+	switch f {
+	case CompressedDXT1, CompressedBC4, CompressedBC4Signed:
+		return 8
+	}
+	return 16
+}
+
+// LevelSize returns the size of a width by height image of format f.
+func (f CompressedFormat) LevelSize(width, height int) int {
+	return ((width + 3) / 4) * ((height + 3) / 4) * f.BlockSize()
+}
+
+// CompressedImage is a decoded block compressed texture image.
+// DDSImage.CompressedImage returns the one of a 2D DDS texture.
+type CompressedImage struct {
+	Width  int
+	Height int
+	Format CompressedFormat
+	// Levels holds the mipmaps, from the full size image down to at most
+	// 1x1, each halving the size of the previous one. Unlike Image, rows of
+	// blocks start from the top one, as block compressed files store them.
+	Levels [][]byte
+}
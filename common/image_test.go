@@ -0,0 +1,46 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestValidate checks the sizes UploadImage and UploadDDSImage rely on
+// before giving pixels to OpenGL.
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		img   Image
+		valid bool
+	}{
+		{"empty", Image{}, false},
+		{"no pixels", Image{Width: 2, Height: 2, Format: PixelRGB8}, false},
+		{"short", Image{Width: 2, Height: 2, Format: PixelRGB8, Pix: make([]byte, 11)}, false},
+		{"complete", Image{Width: 2, Height: 2, Format: PixelRGB8, Pix: make([]byte, 12)}, true},
+	} {
+		if err := tc.img.validate(); (err == nil) != tc.valid {
+			t.Errorf("image %s: got %v", tc.name, err)
+		}
+	}
+
+	dxt1 := DDSImage{Width: 8, Height: 4, Depth: 1, Layers: 1, Compressed: true, CompressedFormat: CompressedDXT1}
+	cube := DDSImage{Width: 2, Height: 2, Depth: 1, Layers: 1, Cube: true, PixelFormat: PixelGray8}
+	for _, tc := range []struct {
+		name   string
+		img    DDSImage
+		levels [][]byte
+		valid  bool
+	}{
+		{"empty", DDSImage{}, nil, false},
+		{"no levels", dxt1, nil, false},
+		{"empty level", dxt1, [][]byte{{}}, false},
+		{"mipmaps", dxt1, [][]byte{make([]byte, 16), make([]byte, 8), make([]byte, 8), make([]byte, 8)}, true},
+		{"short mipmap", dxt1, [][]byte{make([]byte, 16), make([]byte, 4)}, false},
+		{"cube map", cube, [][]byte{make([]byte, 24), make([]byte, 6)}, true},
+		{"one face", cube, [][]byte{make([]byte, 4)}, false},
+	} {
+		tc.img.Levels = tc.levels
+		if err := tc.img.validate(); (err == nil) != tc.valid {
+			t.Errorf("DDS image %s: got %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package common
+
+import (
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// ImageOptions controls how DecodeImage and ConvertImage build their Image.
+// A nil *ImageOptions is the same as the zero value.
+type ImageOptions struct {
+	// SRGB uploads the image as sRGB8_ALPHA8 rather than RGBA8. Use it for
+	// color textures, but not for data such as normal maps.
+	SRGB bool
+	// FlipVertical turns the image upside down, which leaves the top row
+	// first like in DDS textures, for meshes loaded with VFlipNegate or
+	// VFlipOneMinus.
+	FlipVertical bool
+	// Premultiply multiplies colors by alpha, for blending with ONE and
+	// ONE_MINUS_SRC_ALPHA and for filtering without dark fringes.
+	Premultiply bool
+}
+
+// DecodeImage reads an image of any format registered with the image
+// package, which includes PNG, JPEG and GIF, and converts it with
+// ConvertImage.
+func DecodeImage(r io.Reader, opts *ImageOptions) (Image, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return Image{}, err
+	}
+	return ConvertImage(src, opts), nil
+}
+
+// ConvertImage converts src into tightly packed RGBA8 pixels, bottom row
+// first like every Image. Colors have straight alpha unless
+// opts.Premultiply is set.
+func ConvertImage(src image.Image, opts *ImageOptions) Image {
+	if opts == nil {
+		opts = &ImageOptions{}
+	}
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	img := Image{Width: width, Height: height, Format: PixelRGBA8, SRGB: opts.SRGB}
+	img.Pix = make([]byte, 4*width*height)
+
+	// Palettes are converted once
+	var palette []color.NRGBA
+	if paletted, ok := src.(*image.Paletted); ok {
+		palette = make([]color.NRGBA, len(paletted.Palette))
+		for i, c := range paletted.Palette {
+			palette[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		// Image rows start from the top, ours from the bottom
+		row := height - 1 - y
+		if opts.FlipVertical {
+			row = y
+		}
+		dst := img.Pix[4*width*row : 4*width*(row+1)]
+		sy := bounds.Min.Y + y
+
+		// Common image types are read directly, others through At
+		switch src := src.(type) {
+		case *image.NRGBA:
+			i := src.PixOffset(bounds.Min.X, sy)
+			copy(dst, src.Pix[i:i+4*width])
+		case *image.RGBA:
+			i := src.PixOffset(bounds.Min.X, sy)
+			copy(dst, src.Pix[i:i+4*width])
+			if !opts.Premultiply {
+				unpremultiply(dst)
+			}
+		case *image.YCbCr:
+			for x := 0; x < width; x++ {
+				yi := src.YOffset(bounds.Min.X+x, sy)
+				ci := src.COffset(bounds.Min.X+x, sy)
+				r, g, b := color.YCbCrToRGB(src.Y[yi], src.Cb[ci], src.Cr[ci])
+				dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = r, g, b, 0xff
+			}
+		case *image.Gray:
+			i := src.PixOffset(bounds.Min.X, sy)
+			for x, v := range src.Pix[i : i+width] {
+				dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = v, v, v, 0xff
+			}
+		case *image.Paletted:
+			i := src.PixOffset(bounds.Min.X, sy)
+			for x, index := range src.Pix[i : i+width] {
+				var c color.NRGBA
+				if int(index) < len(palette) {
+					c = palette[index]
+				}
+				dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = c.R, c.G, c.B, c.A
+			}
+		default:
+			for x := 0; x < width; x++ {
+				c := color.NRGBAModel.Convert(src.At(bounds.Min.X+x, sy)).(color.NRGBA)
+				dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = c.R, c.G, c.B, c.A
+			}
+		}
+		if _, ok := src.(*image.RGBA); opts.Premultiply && !ok {
+			premultiply(dst)
+		}
+	}
+	return img
+}
+
+// premultiply multiplies the colors of RGBA pixels by their alpha.
+func premultiply(pix []byte) {
+	for i := 0; i < len(pix); i += 4 {
+		a := uint32(pix[i+3])
+		if a == 0xff {
+			continue
+		}
+		for c := i; c < i+3; c++ {
+			pix[c] = byte((uint32(pix[c])*a + 127) / 255)
+		}
+	}
+}
+
+// unpremultiply divides the colors of premultiplied RGBA pixels by their
+// alpha.
+func unpremultiply(pix []byte) {
+	for i := 0; i < len(pix); i += 4 {
+		a := uint32(pix[i+3])
+		if a == 0xff || a == 0 {
+			continue
+		}
+		for c := i; c < i+3; c++ {
+			pix[c] = byte(min((uint32(pix[c])*255+a/2)/a, 255))
+		}
+	}
+}
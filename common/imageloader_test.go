@@ -0,0 +1,146 @@
+package common
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+// imageRows returns the pixels of rows given from the top, in the bottom
+// row first order of Image.
+func imageRows(rows ...[]byte) []byte {
+	var pix []byte
+	for i := len(rows) - 1; i >= 0; i-- {
+		pix = append(pix, rows[i]...)
+	}
+	return pix
+}
+
+func TestDecodeImage(t *testing.T) {
+	// 2x2, with a transparent and a half transparent pixel on the top row
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	nrgba.Pix = []byte{
+		200, 100, 50, 128, 0, 0, 0, 0,
+		10, 20, 30, 255, 40, 50, 60, 255,
+	}
+	paletted := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{
+		color.NRGBA{255, 0, 0, 255},
+		color.NRGBA{0, 0, 255, 128},
+	})
+	paletted.Pix = []byte{1, 0}
+	gray := image.NewGray(image.Rect(0, 0, 2, 1))
+	gray.Pix = []byte{10, 200}
+	// 16x16 in 8x8 blocks of one grey, which JPEG encodes losslessly,
+	// white at the top and black at the bottom
+	blocks := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			blocks.Set(x, y, color.White)
+			blocks.Set(x, y+8, color.Black)
+		}
+	}
+	white := bytes.Repeat([]byte{255, 255, 255, 255}, 16)
+	black := bytes.Repeat([]byte{0, 0, 0, 255}, 16)
+	halves := func(top, bottom []byte) []byte {
+		var rows [][]byte
+		for i := 0; i < 16; i++ {
+			rows = append(rows, top)
+			if i >= 8 {
+				rows[i] = bottom
+			}
+		}
+		return imageRows(rows...)
+	}
+
+	encodePNG := func(img image.Image) ([]byte, error) {
+		var buf bytes.Buffer
+		err := png.Encode(&buf, img)
+		return buf.Bytes(), err
+	}
+	encodeJPEG := func(img image.Image) ([]byte, error) {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100})
+		return buf.Bytes(), err
+	}
+
+	for _, tc := range []struct {
+		name   string
+		src    image.Image
+		encode func(image.Image) ([]byte, error)
+		// Type DecodeImage gets from the image package
+		decoded image.Image
+		opts    *ImageOptions
+		pix     []byte
+	}{
+		{"NRGBA", nrgba, encodePNG, &image.NRGBA{}, nil, imageRows(
+			[]byte{200, 100, 50, 128, 0, 0, 0, 0},
+			[]byte{10, 20, 30, 255, 40, 50, 60, 255},
+		)},
+		{"NRGBA flipped", nrgba, encodePNG, &image.NRGBA{}, &ImageOptions{FlipVertical: true}, []byte{
+			200, 100, 50, 128, 0, 0, 0, 0,
+			10, 20, 30, 255, 40, 50, 60, 255,
+		}},
+		{"NRGBA premultiplied", nrgba, encodePNG, &image.NRGBA{}, &ImageOptions{Premultiply: true}, imageRows(
+			[]byte{100, 50, 25, 128, 0, 0, 0, 0},
+			[]byte{10, 20, 30, 255, 40, 50, 60, 255},
+		)},
+		{"paletted", paletted, encodePNG, &image.Paletted{}, nil, []byte{0, 0, 255, 128, 255, 0, 0, 255}},
+		{"paletted premultiplied", paletted, encodePNG, &image.Paletted{}, &ImageOptions{Premultiply: true}, []byte{0, 0, 128, 128, 255, 0, 0, 255}},
+		{"gray", gray, encodePNG, &image.Gray{}, nil, []byte{10, 10, 10, 255, 200, 200, 200, 255}},
+		{"YCbCr", blocks, encodeJPEG, &image.YCbCr{}, nil, halves(white, black)},
+		{"YCbCr flipped", blocks, encodeJPEG, &image.YCbCr{}, &ImageOptions{FlipVertical: true, SRGB: true}, halves(black, white)},
+	} {
+		data, err := tc.encode(tc.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := reflect.TypeOf(decoded), reflect.TypeOf(tc.decoded); got != want {
+			t.Fatalf("%s: decoded as %v, want %v", tc.name, got, want)
+		}
+
+		img, err := DecodeImage(bytes.NewReader(data), tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bounds := tc.src.Bounds()
+		if img.Width != bounds.Dx() || img.Height != bounds.Dy() || img.Format != PixelRGBA8 {
+			t.Errorf("%s: %dx%d image of format %d", tc.name, img.Width, img.Height, img.Format)
+		}
+		if srgb := tc.opts != nil && tc.opts.SRGB; img.SRGB != srgb {
+			t.Errorf("%s: sRGB %v, want %v", tc.name, img.SRGB, srgb)
+		}
+		if !bytes.Equal(img.Pix, tc.pix) {
+			t.Errorf("%s: pixels %v, want %v", tc.name, img.Pix, tc.pix)
+		}
+	}
+}
+
+func TestConvertImageRGBA(t *testing.T) {
+	// Premultiplied pixels, of a sub-image that doesn't start at 0, 0
+	rgba := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	rgba.Pix = []byte{
+		9, 9, 9, 9, 9, 9, 9, 9,
+		100, 50, 25, 128, 10, 20, 30, 255,
+	}
+	src := rgba.SubImage(image.Rect(0, 1, 2, 2))
+	for _, tc := range []struct {
+		opts *ImageOptions
+		pix  []byte
+	}{
+		{nil, []byte{199, 100, 50, 128, 10, 20, 30, 255}},
+		{&ImageOptions{Premultiply: true}, []byte{100, 50, 25, 128, 10, 20, 30, 255}},
+	} {
+		img := ConvertImage(src, tc.opts)
+		if img.Width != 2 || img.Height != 1 || !bytes.Equal(img.Pix, tc.pix) {
+			t.Errorf("%+v: %dx%d image with pixels %v, want %v", tc.opts, img.Width, img.Height, img.Pix, tc.pix)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Mesh is a list of triangles. When Indices is nil every three consecutive
+// vertices form one triangle, otherwise every three consecutive indices do.
+// Uvs, Normals and Colors are nil when the source has no such attribute.
+type Mesh struct {
+	Indices  []uint32
+	Vertices []mgl32.Vec3
+	Uvs      []mgl32.Vec2
+	Normals  []mgl32.Vec3
+	// Colors are RGBA vertex colors in [0, 1].
+	Colors []mgl32.Vec4
+
+	// Tangents and Bitangents are set by ComputeTangents, or by loaders of
+	// formats that store tangents. The w component of a tangent is the
+	// handedness of the basis.
+	Tangents   []mgl32.Vec4
+	Bitangents []mgl32.Vec3
+
+	// Polygons is the number of faces read from the source and Triangulated
+	// how many of them had more than three vertices and were split.
+	Polygons     int
+	Triangulated int
+
+	// SubMeshes splits the triangles into runs sharing one material, in
+	// source order. Materials holds the definitions found in MaterialLibs.
+	SubMeshes    []SubMesh
+	MaterialLibs []string
+	Materials    map[string]*Material
+
+	// Smoothing holds the smoothing group of each triangle, 0 meaning none.
+	// It is nil when no triangle is smoothed.
+	Smoothing []uint32
+}
+
+// SubMesh is a range of vertices, or of indices if the mesh is indexed, drawn
+// with the same material. First and Count are what gl.DrawArrays or
+// gl.DrawElements expect.
+type SubMesh struct {
+	Material string
+	First    int
+	Count    int
+}
+
+// Model is a Mesh whose triangles are organised in named objects, themselves
+// split into groups. Both cover contiguous ranges of the mesh.
+type Model struct {
+	Mesh
+	Objects []Object
+
+	// Nodes is the scene hierarchy of formats that have one, such as glTF,
+	// with parents before their children. It is nil for OBJ files.
+	Nodes []Node
+	// Images holds the textures embedded in the file, by the name materials
+	// refer to them with.
+	Images map[string][]byte
+}
+
+// Node is a node of a scene hierarchy. The vertices of its mesh are already
+// transformed by World, which is its parent's World times Local.
+type Node struct {
+	Name   string
+	Parent int // index in Model.Nodes, -1 for roots
+	Local  mgl32.Mat4
+	World  mgl32.Mat4
+	Object int // index in Model.Objects, -1 for nodes without a mesh
+}
+
+// Object is a named part of a Model, from an OBJ "o" statement.
+type Object struct {
+	Name   string
+	First  int
+	Count  int
+	Groups []Group
+}
+
+// Group is a named range of an Object, from an OBJ "g" statement. First and
+// Count use the same units as SubMesh.
+type Group struct {
+	Name  string
+	First int
+	Count int
+}
+
+// TriangleCount returns the number of triangles in m.
+func (m *Mesh) TriangleCount() int {
+	if m.Indices != nil {
+		return len(m.Indices) / 3
+	}
+	return len(m.Vertices) / 3
+}
+
+// Triangle returns the vertex indices of the i-th triangle of m, whether m is
+// indexed or not.
+func (m *Mesh) Triangle(i int) (uint32, uint32, uint32) {
+	if m.Indices != nil {
+		return m.Indices[3*i], m.Indices[3*i+1], m.Indices[3*i+2]
+	}
+	return uint32(3 * i), uint32(3*i + 1), uint32(3*i + 2)
+}
+
+// beginSubMesh ends the current sub-mesh and starts one using material from
+// vertex at onwards.
+func (m *Mesh) beginSubMesh(material string, at int) {
+	m.endSubMesh(at)
+	if n := len(m.SubMeshes); n > 0 && m.SubMeshes[n-1].Material == material {
+		return
+	}
+	m.SubMeshes = append(m.SubMeshes, SubMesh{Material: material, First: at})
+}
+
+// endSubMesh ends the current sub-mesh before vertex at, dropping it if empty.
+func (m *Mesh) endSubMesh(at int) {
+	n := len(m.SubMeshes)
+	if n == 0 {
+		return
+	}
+	last := &m.SubMeshes[n-1]
+	last.Count = at - last.First
+	if last.Count == 0 {
+		m.SubMeshes = m.SubMeshes[:n-1]
+	}
+}
+
+// beginObject ends the current object and starts a new one from vertex at
+// onwards, with an unnamed group for the faces that come before any "g"
+// statement.
+func (m *Model) beginObject(name string, at int) {
+	m.endObject(at)
+	m.Objects = append(m.Objects, Object{Name: name, First: at})
+	m.beginGroup("", at)
+}
+
+// endObject ends the current object before vertex at, dropping it if empty.
+func (m *Model) endObject(at int) {
+	n := len(m.Objects)
+	if n == 0 {
+		return
+	}
+	m.endGroup(at)
+	last := &m.Objects[n-1]
+	last.Count = at - last.First
+	if last.Count == 0 {
+		m.Objects = m.Objects[:n-1]
+	}
+}
+
+// beginGroup ends the current group and starts a new one in the current
+// object from vertex at onwards.
+func (m *Model) beginGroup(name string, at int) {
+	m.endGroup(at)
+	object := &m.Objects[len(m.Objects)-1]
+	if n := len(object.Groups); n > 0 && object.Groups[n-1].Name == name {
+		return
+	}
+	object.Groups = append(object.Groups, Group{Name: name, First: at})
+}
+
+// endGroup ends the current group before vertex at, dropping it if empty.
+func (m *Model) endGroup(at int) {
+	object := &m.Objects[len(m.Objects)-1]
+	n := len(object.Groups)
+	if n == 0 {
+		return
+	}
+	last := &object.Groups[n-1]
+	last.Count = at - last.First
+	if last.Count == 0 {
+		object.Groups = object.Groups[:n-1]
+	}
+}
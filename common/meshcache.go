@@ -0,0 +1,437 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Mesh cache files start with this magic and version. Bump the version when
+// the layout changes so old caches are rebuilt.
+const (
+	meshCacheMagic   = "MSHC"
+	meshCacheVersion = 1
+)
+
+// Errors returned by ReadMeshCache.
+var (
+	ErrMeshCacheFormat   = errors.New("not a mesh cache file")
+	ErrMeshCacheVersion  = errors.New("unsupported mesh cache version")
+	ErrMeshCacheChecksum = errors.New("mesh cache checksum mismatch")
+)
+
+// AttributeSemantic tells what a vertex attribute of MeshBuffers holds.
+type AttributeSemantic uint32
+
+const (
+	AttributePosition AttributeSemantic = iota
+	AttributeUv
+	AttributeNormal
+	AttributeTangent
+	AttributeBitangent
+	AttributeColor
+)
+
+// VertexAttribute describes one float32 attribute of an interleaved vertex.
+// Offset is in bytes from the start of the vertex, as gl.VertexAttribPointer
+// expects.
+type VertexAttribute struct {
+	Semantic   AttributeSemantic
+	Components int
+	Offset     int
+}
+
+// MeshBuffers is an indexed Mesh laid out the way OpenGL takes it: Vertices
+// can be handed to gl.BufferData for gl.ARRAY_BUFFER and Indices for
+// gl.ELEMENT_ARRAY_BUFFER, both in the machine's byte order.
+type MeshBuffers struct {
+	Attributes  []VertexAttribute
+	Stride      int
+	VertexCount int
+	Vertices    []byte
+
+	// IndexSize is 2 for gl.UNSIGNED_SHORT indices and 4 for gl.UNSIGNED_INT.
+	IndexSize  int
+	IndexCount int
+	Indices    []byte
+
+	SubMeshes []SubMesh
+}
+
+// NewMeshBuffers interleaves the attributes of m, indexing it first if needed.
+// Indices are 16 bits wide when the vertex count allows it.
+func NewMeshBuffers(m Mesh) MeshBuffers {
+	if m.Indices == nil {
+		m = IndexMesh(m)
+	}
+
+	var b MeshBuffers
+	addAttribute := func(semantic AttributeSemantic, components int) {
+		b.Attributes = append(b.Attributes, VertexAttribute{Semantic: semantic, Components: components, Offset: b.Stride})
+		b.Stride += 4 * components
+	}
+	addAttribute(AttributePosition, 3)
+	if m.Uvs != nil {
+		addAttribute(AttributeUv, 2)
+	}
+	if m.Normals != nil {
+		addAttribute(AttributeNormal, 3)
+	}
+	if m.Tangents != nil {
+		addAttribute(AttributeTangent, 4)
+		addAttribute(AttributeBitangent, 3)
+	}
+	if m.Colors != nil {
+		addAttribute(AttributeColor, 4)
+	}
+
+	b.VertexCount = len(m.Vertices)
+	vertex := make([]float32, 0, b.Stride/4)
+	b.Vertices = make([]byte, 0, b.VertexCount*b.Stride)
+	for i := range m.Vertices {
+		vertex = append(vertex[:0], m.Vertices[i][:]...)
+		if m.Uvs != nil {
+			vertex = append(vertex, m.Uvs[i][:]...)
+		}
+		if m.Normals != nil {
+			vertex = append(vertex, m.Normals[i][:]...)
+		}
+		if m.Tangents != nil {
+			vertex = append(vertex, m.Tangents[i][:]...)
+			vertex = append(vertex, m.Bitangents[i][:]...)
+		}
+		if m.Colors != nil {
+			vertex = append(vertex, m.Colors[i][:]...)
+		}
+		for _, f := range vertex {
+			b.Vertices = binary.NativeEndian.AppendUint32(b.Vertices, math.Float32bits(f))
+		}
+	}
+
+	b.IndexCount = len(m.Indices)
+	// Meshes without indices keep the smaller index size
+	if indices, ok := m.Indices16(); ok || m.Indices == nil {
+		b.IndexSize = 2
+		b.Indices = make([]byte, 0, 2*len(indices))
+		for _, index := range indices {
+			b.Indices = binary.NativeEndian.AppendUint16(b.Indices, index)
+		}
+	} else {
+		b.IndexSize = 4
+		b.Indices = make([]byte, 0, 4*len(m.Indices))
+		for _, index := range m.Indices {
+			b.Indices = binary.NativeEndian.AppendUint32(b.Indices, index)
+		}
+	}
+
+	b.SubMeshes = m.SubMeshes
+	return b
+}
+
+// SourceStamp identifies the source a mesh cache was built from. Options
+// tells apart caches of the same file loaded with different OBJOptions.
+type SourceStamp struct {
+	Size    int64
+	ModTime int64 // Unix nanoseconds
+	Hash    [sha256.Size]byte
+	Options uint64
+}
+
+// meshCacheHeader is the fixed size start of a mesh cache file.
+type meshCacheHeader struct {
+	Magic          [4]byte
+	Version        uint32
+	Stamp          SourceStamp
+	BigEndian      uint32
+	Stride         uint32
+	AttributeCount uint32
+	VertexCount    uint32
+	IndexSize      uint32
+	IndexCount     uint32
+	SubMeshCount   uint32
+}
+
+type meshCacheAttribute struct {
+	Semantic   uint32
+	Components uint32
+	Offset     uint32
+}
+
+type meshCacheSubMesh struct {
+	First     uint32
+	Count     uint32
+	NameBytes uint32
+}
+
+// Limits of the header fields, since the checksum is only known at the end
+const (
+	maxMeshCacheStride = 1024
+	maxMeshCacheCount  = 1 << 28
+)
+
+// WriteMeshCache writes b to w in the binary mesh cache format : a header
+// holding stamp, the attribute layout, the vertex and index buffers, the
+// sub-meshes and a CRC-32 of everything before it.
+func WriteMeshCache(w io.Writer, b MeshBuffers, stamp SourceStamp) error {
+	bw := bufio.NewWriter(w)
+	checksum := crc32.NewIEEE()
+	out := io.MultiWriter(bw, checksum)
+
+	header := meshCacheHeader{
+		Version:        meshCacheVersion,
+		Stamp:          stamp,
+		Stride:         uint32(b.Stride),
+		AttributeCount: uint32(len(b.Attributes)),
+		VertexCount:    uint32(b.VertexCount),
+		IndexSize:      uint32(b.IndexSize),
+		IndexCount:     uint32(b.IndexCount),
+		SubMeshCount:   uint32(len(b.SubMeshes)),
+	}
+	copy(header.Magic[:], meshCacheMagic)
+	if binary.NativeEndian.Uint16([]byte{0, 1}) == 1 {
+		header.BigEndian = 1
+	}
+	if err := binary.Write(out, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	for _, attribute := range b.Attributes {
+		a := meshCacheAttribute{uint32(attribute.Semantic), uint32(attribute.Components), uint32(attribute.Offset)}
+		if err := binary.Write(out, binary.LittleEndian, &a); err != nil {
+			return err
+		}
+	}
+	if _, err := out.Write(b.Vertices); err != nil {
+		return err
+	}
+	if _, err := out.Write(b.Indices); err != nil {
+		return err
+	}
+	for _, subMesh := range b.SubMeshes {
+		s := meshCacheSubMesh{uint32(subMesh.First), uint32(subMesh.Count), uint32(len(subMesh.Material))}
+		if err := binary.Write(out, binary.LittleEndian, &s); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(out, subMesh.Material); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(bw, binary.LittleEndian, checksum.Sum32()); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadMeshCache reads a mesh cache written by WriteMeshCache on a machine of
+// the same byte order.
+func ReadMeshCache(r io.Reader) (MeshBuffers, SourceStamp, error) {
+	checksum := crc32.NewIEEE()
+	in := io.TeeReader(bufio.NewReader(r), checksum)
+	fail := func(err error) (MeshBuffers, SourceStamp, error) {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrMeshCacheFormat
+		}
+		return MeshBuffers{}, SourceStamp{}, err
+	}
+
+	var header meshCacheHeader
+	if err := binary.Read(in, binary.LittleEndian, &header); err != nil {
+		return fail(err)
+	}
+	if string(header.Magic[:]) != meshCacheMagic {
+		return fail(ErrMeshCacheFormat)
+	}
+	if header.Version != meshCacheVersion {
+		return fail(ErrMeshCacheVersion)
+	}
+	bigEndian := binary.NativeEndian.Uint16([]byte{0, 1}) == 1
+	if (header.BigEndian == 1) != bigEndian {
+		return fail(fmt.Errorf("%w: written with another byte order", ErrMeshCacheFormat))
+	}
+	if header.Stride > maxMeshCacheStride || header.AttributeCount > maxMeshCacheStride ||
+		header.VertexCount > maxMeshCacheCount || header.IndexCount > maxMeshCacheCount ||
+		header.SubMeshCount > maxMeshCacheCount || (header.IndexSize != 2 && header.IndexSize != 4) {
+		return fail(ErrMeshCacheFormat)
+	}
+
+	b := MeshBuffers{
+		Stride:      int(header.Stride),
+		VertexCount: int(header.VertexCount),
+		IndexSize:   int(header.IndexSize),
+		IndexCount:  int(header.IndexCount),
+	}
+	for i := 0; i < int(header.AttributeCount); i++ {
+		var a meshCacheAttribute
+		if err := binary.Read(in, binary.LittleEndian, &a); err != nil {
+			return fail(err)
+		}
+		b.Attributes = append(b.Attributes, VertexAttribute{AttributeSemantic(a.Semantic), int(a.Components), int(a.Offset)})
+	}
+	var err error
+	if b.Vertices, err = readMeshCacheBytes(in, b.VertexCount*b.Stride); err != nil {
+		return fail(err)
+	}
+	if b.Indices, err = readMeshCacheBytes(in, b.IndexCount*b.IndexSize); err != nil {
+		return fail(err)
+	}
+	for i := 0; i < int(header.SubMeshCount); i++ {
+		var s meshCacheSubMesh
+		if err := binary.Read(in, binary.LittleEndian, &s); err != nil {
+			return fail(err)
+		}
+		if s.NameBytes > maxMeshCacheStride {
+			return fail(ErrMeshCacheFormat)
+		}
+		name, err := readMeshCacheBytes(in, int(s.NameBytes))
+		if err != nil {
+			return fail(err)
+		}
+		b.SubMeshes = append(b.SubMeshes, SubMesh{Material: string(name), First: int(s.First), Count: int(s.Count)})
+	}
+
+	// The checksum itself isn't part of what it covers
+	sum := checksum.Sum32()
+	var stored uint32
+	if err := binary.Read(in, binary.LittleEndian, &stored); err != nil {
+		return fail(err)
+	}
+	if stored != sum {
+		return fail(ErrMeshCacheChecksum)
+	}
+	// The buffers go straight to OpenGL, which doesn't check them
+	if err := b.validate(); err != nil {
+		return fail(err)
+	}
+	return b, header.Stamp, nil
+}
+
+// readMeshCacheBytes reads n bytes from r. The buffer grows as data arrives,
+// so a corrupt size fails at the end of the file rather than allocating it
+// all up front.
+func readMeshCacheBytes(r io.Reader, n int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(min(n, 64*1024))
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// validate checks that attributes fit in a vertex, and that indices and
+// sub-meshes stay within the buffers.
+func (b *MeshBuffers) validate() error {
+	for _, a := range b.Attributes {
+		if a.Components < 1 || a.Components > 4 || a.Offset < 0 || a.Offset+4*a.Components > b.Stride {
+			return fmt.Errorf("%w: attribute %d doesn't fit in a %d byte vertex", ErrMeshCacheFormat, a.Semantic, b.Stride)
+		}
+	}
+	for i := 0; i < b.IndexCount; i++ {
+		var index int
+		if b.IndexSize == 2 {
+			index = int(binary.NativeEndian.Uint16(b.Indices[2*i:]))
+		} else {
+			index = int(binary.NativeEndian.Uint32(b.Indices[4*i:]))
+		}
+		if index >= b.VertexCount {
+			return fmt.Errorf("%w: index %d out of range", ErrMeshCacheFormat, index)
+		}
+	}
+	for _, s := range b.SubMeshes {
+		if s.First+s.Count > b.IndexCount {
+			return fmt.Errorf("%w: sub-mesh %q out of range", ErrMeshCacheFormat, s.Material)
+		}
+	}
+	return nil
+}
+
+// LoadOBJCached loads the OBJ file at path as MeshBuffers, going through a
+// cache file next to it, named path + ".meshcache". The cache is rebuilt when
+// the options differ or when the source changed: its size and modification
+// time are checked first, and if those differ its hash is compared so that
+// touching the file doesn't force a reparse. Failing to write the cache isn't
+// an error, the mesh is simply parsed again next time.
+func LoadOBJCached(path string, opts *OBJOptions) (MeshBuffers, error) {
+	if opts == nil {
+		opts = &OBJOptions{}
+	}
+	cachePath := path + ".meshcache"
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return MeshBuffers{}, err
+	}
+	stamp := SourceStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Options: objOptionsKey(opts)}
+
+	cached, cachedStamp, cacheErr := loadMeshCache(cachePath)
+	if cacheErr == nil && cachedStamp.Options == stamp.Options &&
+		cachedStamp.Size == stamp.Size && cachedStamp.ModTime == stamp.ModTime {
+		return cached, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MeshBuffers{}, err
+	}
+	stamp.Hash = sha256.Sum256(data)
+	if cacheErr == nil && cachedStamp.Options == stamp.Options && cachedStamp.Hash == stamp.Hash {
+		// Same content, only refresh the stamp
+		saveMeshCache(cachePath, cached, stamp)
+		return cached, nil
+	}
+
+	mesh, err := ReadOBJ(bytes.NewReader(data), path, opts)
+	if err != nil {
+		return MeshBuffers{}, err
+	}
+	b := NewMeshBuffers(mesh)
+	saveMeshCache(cachePath, b, stamp)
+	return b, nil
+}
+
+// objOptionsKey hashes the options that change the parsed mesh.
+func objOptionsKey(opts *OBJOptions) uint64 {
+	key := fmt.Sprintf("flip=%d", opts.FlipV)
+	if opts.Normals != nil {
+		key += fmt.Sprintf(" normals=%+v", *opts.Normals)
+	}
+	return uint64(crc32.ChecksumIEEE([]byte(key)))
+}
+
+func loadMeshCache(path string) (MeshBuffers, SourceStamp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return MeshBuffers{}, SourceStamp{}, err
+	}
+	defer f.Close()
+
+	return ReadMeshCache(f)
+}
+
+// saveMeshCache writes the cache to a temporary file first so that a reader
+// never sees half of it. Each call has its own temporary file, so concurrent
+// writers each replace the cache with a whole one.
+func saveMeshCache(path string, b MeshBuffers, stamp SourceStamp) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return
+	}
+	tmp := f.Name()
+	err = WriteMeshCache(f, b, stamp)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+}
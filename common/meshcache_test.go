@@ -0,0 +1,153 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func suzanneBuffers(t *testing.T) MeshBuffers {
+	t.Helper()
+	mesh, err := LoadOBJFile(suzannePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMeshBuffers(mesh)
+}
+
+// resum replaces the checksum at the end of a cache file after it was edited.
+func resum(data []byte) {
+	end := len(data) - 4
+	binary.LittleEndian.PutUint32(data[end:], crc32.ChecksumIEEE(data[:end]))
+}
+
+func TestMeshCacheRoundTrip(t *testing.T) {
+	want := suzanneBuffers(t)
+	stamp := SourceStamp{Size: 1, ModTime: 2, Options: 3}
+	var buf bytes.Buffer
+	if err := WriteMeshCache(&buf, want, stamp); err != nil {
+		t.Fatal(err)
+	}
+	got, gotStamp, err := ReadMeshCache(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotStamp != stamp {
+		t.Errorf("stamp %+v, want %+v", gotStamp, stamp)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("buffers changed")
+	}
+}
+
+func TestMeshCacheCorrupt(t *testing.T) {
+	b := suzanneBuffers(t)
+	var buf bytes.Buffer
+	if err := WriteMeshCache(&buf, b, SourceStamp{}); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	headerSize := binary.Size(meshCacheHeader{})
+	attributeSize := binary.Size(meshCacheAttribute{})
+	field := func(name string) int {
+		f, _ := reflect.TypeOf(meshCacheHeader{}).FieldByName(name)
+		return int(f.Offset)
+	}
+	stride := int(binary.LittleEndian.Uint32(file[field("Stride"):]))
+	vertexCount := int(binary.LittleEndian.Uint32(file[field("VertexCount"):]))
+	indices := headerSize + 3*attributeSize + vertexCount*stride
+
+	for _, tc := range []struct {
+		name   string
+		edit   func(data []byte) []byte
+		resum  bool
+		target error
+	}{
+		{"truncated", func(data []byte) []byte { return data[:len(data)/2] }, false, ErrMeshCacheFormat},
+		{"flipped bit", func(data []byte) []byte { data[len(data)/2] ^= 1; return data }, false, ErrMeshCacheChecksum},
+		{"huge counts", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[field("Stride"):], maxMeshCacheStride)
+			binary.LittleEndian.PutUint32(data[field("VertexCount"):], maxMeshCacheCount)
+			return data[:headerSize+100]
+		}, false, ErrMeshCacheFormat},
+		{"attribute past stride", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[headerSize+2*attributeSize+8:], uint32(stride))
+			return data
+		}, true, ErrMeshCacheFormat},
+		{"index out of range", func(data []byte) []byte {
+			binary.NativeEndian.PutUint16(data[indices:], uint16(vertexCount))
+			return data
+		}, true, ErrMeshCacheFormat},
+		{"sub-mesh out of range", func(data []byte) []byte {
+			last := b.SubMeshes[len(b.SubMeshes)-1]
+			subMesh := len(data) - 4 - len(last.Material) - binary.Size(meshCacheSubMesh{})
+			binary.LittleEndian.PutUint32(data[subMesh+4:], 1<<20)
+			return data
+		}, true, ErrMeshCacheFormat},
+	} {
+		data := tc.edit(bytes.Clone(file))
+		if tc.resum {
+			resum(data)
+		}
+		_, _, err := ReadMeshCache(bytes.NewReader(data))
+		if !errors.Is(err, tc.target) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.target)
+		}
+	}
+}
+
+func TestSaveMeshCacheConcurrent(t *testing.T) {
+	// Each writer has its own vertices, so that a mix of two is noticed
+	buffers := make([]MeshBuffers, 8)
+	for i := range buffers {
+		buffers[i] = suzanneBuffers(t)
+		for k := range buffers[i].Vertices {
+			buffers[i].Vertices[k] ^= byte(i)
+		}
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "suzanne.obj.meshcache")
+
+	// A file being written by someone else is left alone
+	other := filepath.Join(dir, "suzanne.obj.meshcache.tmp")
+	if err := os.WriteFile(other, []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saveMeshCache(path, buffers[0], SourceStamp{})
+	if data, err := os.ReadFile(other); err != nil || string(data) != "partial" {
+		t.Fatalf("other writer's file: %q, %v", data, err)
+	}
+	if err := os.Remove(other); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writers racing to replace the cache each leave a whole one, and no
+	// temporary file
+	var wg sync.WaitGroup
+	for i := range buffers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				saveMeshCache(path, buffers[i], SourceStamp{Size: int64(i), ModTime: int64(j)})
+			}
+		}(i)
+	}
+	wg.Wait()
+	cached, stamp, err := loadMeshCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stamp.Size < 0 || stamp.Size >= int64(len(buffers)) || !reflect.DeepEqual(cached, buffers[stamp.Size]) {
+		t.Errorf("cache with stamp %+v mixes writers", stamp)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("%d files left, want 1", len(entries))
+	}
+}
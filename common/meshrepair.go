@@ -0,0 +1,328 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// weldAttributeTolerance is how much the attributes other than the position
+// may differ for WeldVertices to merge two vertices.
+const weldAttributeTolerance = 1e-4
+
+// DropDegenerates returns a copy of m without the triangles ValidateMesh
+// reports as degenerate or referring to vertices that don't exist, or whose
+// positions aren't numbers. Sub-meshes and smoothing groups follow the
+// triangles they belong to, and sub-meshes left empty are removed.
+func DropDegenerates(m Mesh) Mesh {
+	out, _ := dropDegenerates(m)
+	return out
+}
+
+// DropModelDegenerates is DropDegenerates for a Model, whose objects and groups
+// are also updated. They are kept even if they end up empty.
+func DropModelDegenerates(m Model) Model {
+	mesh, remap := dropDegenerates(m.Mesh)
+	out := m
+	out.Mesh = mesh
+	out.Objects = make([]Object, len(m.Objects))
+	for i, object := range m.Objects {
+		object.First, object.Count = remap(object.First, object.Count)
+		groups := make([]Group, len(object.Groups))
+		for j, group := range object.Groups {
+			group.First, group.Count = remap(group.First, group.Count)
+			groups[j] = group
+		}
+		object.Groups = groups
+		out.Objects[i] = object
+	}
+	return out
+}
+
+// dropDegenerates does the work of DropDegenerates, also returning how to
+// convert a range of m into a range of the result.
+func dropDegenerates(m Mesh) (Mesh, func(first, count int) (int, int)) {
+	n := len(m.Vertices)
+	return keepTriangles(m, func(t int, a, b, c uint32) bool {
+		return int(a) < n && int(b) < n && int(c) < n &&
+			!isDegenerate(m.Vertices[a], m.Vertices[b], m.Vertices[c])
+	})
+}
+
+// keepTriangles returns a copy of m with only the triangles keep returns true
+// for, in the same order, along with how to convert a range of m into a range
+// of the result. Sub-meshes and smoothing groups follow their triangles.
+func keepTriangles(m Mesh, keep func(t int, a, b, c uint32) bool) (Mesh, func(first, count int) (int, int)) {
+	triangleCount := m.TriangleCount()
+
+	// Number of triangles kept before each triangle
+	kept := make([]int, triangleCount+1)
+	out := m
+	out.Smoothing = nil
+	if m.Indices != nil {
+		out.Indices = make([]uint32, 0, len(m.Indices))
+	} else {
+		out.clearVertices()
+	}
+	for t := 0; t < triangleCount; t++ {
+		kept[t+1] = kept[t]
+		a, b, c := m.Triangle(t)
+		if !keep(t, a, b, c) {
+			continue
+		}
+		kept[t+1]++
+		if m.Indices != nil {
+			out.Indices = append(out.Indices, a, b, c)
+		} else {
+			for _, i := range [3]uint32{a, b, c} {
+				out.appendVertex(&m, i)
+			}
+		}
+		if m.Smoothing != nil {
+			out.Smoothing = append(out.Smoothing, m.Smoothing[t])
+		}
+	}
+
+	remap := func(first, count int) (int, int) {
+		start := min(first/3, triangleCount)
+		end := min((first+count)/3, triangleCount)
+		return 3 * kept[start], 3 * (kept[end] - kept[start])
+	}
+	out.SubMeshes = nil
+	for _, subMesh := range m.SubMeshes {
+		subMesh.First, subMesh.Count = remap(subMesh.First, subMesh.Count)
+		if subMesh.Count > 0 {
+			out.SubMeshes = append(out.SubMeshes, subMesh)
+		}
+	}
+	return out, remap
+}
+
+// WeldVertices returns an indexed copy of m where vertices closer than
+// distance to an earlier vertex are replaced by it, provided their other
+// attributes are the same. This closes cracks left by exporters that write
+// the same position with slightly different values. A distance of 0 merges
+// identical vertices only, like IndexMesh. Triangles whose corners get welded
+// together become degenerate, see DropDegenerates.
+func WeldVertices(m Mesh, distance float32) Mesh {
+	if distance <= 0 {
+		return IndexMesh(m)
+	}
+
+	// Output vertices by cell of a grid as large as the distance, so that
+	// a vertex only needs to be compared to those of neighbouring cells
+	type cell [3]int64
+	cellOf := func(p mgl32.Vec3) cell {
+		return cell{
+			int64(math.Floor(float64(p[0] / distance))),
+			int64(math.Floor(float64(p[1] / distance))),
+			int64(math.Floor(float64(p[2] / distance))),
+		}
+	}
+	grid := make(map[cell][]uint32)
+
+	out := m
+	out.clearVertices()
+	var outPacked []packedVertex
+	remap := make([]uint32, len(m.Vertices))
+	for i := range m.Vertices {
+		packed := m.packVertex(uint32(i))
+		c := cellOf(packed.position)
+
+		index, found := uint32(0), false
+	search:
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, candidate := range grid[cell{c[0] + dx, c[1] + dy, c[2] + dz}] {
+						if canWeld(&packed, &outPacked[candidate], distance) {
+							index, found = candidate, true
+							break search
+						}
+					}
+				}
+			}
+		}
+		if !found {
+			index = uint32(len(out.Vertices))
+			out.appendVertex(&m, uint32(i))
+			outPacked = append(outPacked, packed)
+			grid[c] = append(grid[c], index)
+		}
+		remap[i] = index
+	}
+
+	out.Indices = make([]uint32, 0, 3*m.TriangleCount())
+	for t := 0; t < m.TriangleCount(); t++ {
+		a, b, c := m.Triangle(t)
+		out.Indices = append(out.Indices, remap[a], remap[b], remap[c])
+	}
+	return out
+}
+
+func canWeld(a, b *packedVertex, distance float32) bool {
+	if a.position.Sub(b.position).Len() > distance {
+		return false
+	}
+	near := func(x, y []float32) bool {
+		for i := range x {
+			if math.Abs(float64(x[i]-y[i])) > weldAttributeTolerance {
+				return false
+			}
+		}
+		return true
+	}
+	return near(a.uv[:], b.uv[:]) && near(a.normal[:], b.normal[:]) &&
+		near(a.color[:], b.color[:]) && near(a.tangent[:], b.tangent[:]) &&
+		near(a.bitangent[:], b.bitangent[:])
+}
+
+// UnifyWinding returns a copy of m where triangles sharing an edge are wound
+// the same way, by flipping those that disagree with their neighbours. Each
+// connected part of the mesh keeps the winding most of its triangles had,
+// except closed parts, which are turned to face outwards. Edges shared by
+// more than two triangles don't connect them. Normals are left as they are.
+func UnifyWinding(m Mesh) Mesh {
+	n := len(m.Vertices)
+	triangleCount := m.TriangleCount()
+	ids, _ := positionIDs(m.Vertices)
+
+	// Corners of every triangle by position, and the triangles of every edge
+	corners := make([][3]int32, triangleCount)
+	valid := make([]bool, triangleCount)
+	edges := make(map[[2]int32][]int)
+	for t := range corners {
+		a, b, c := m.Triangle(t)
+		if int(a) >= n || int(b) >= n || int(c) >= n {
+			continue
+		}
+		valid[t] = true
+		corners[t] = [3]int32{ids[a], ids[b], ids[c]}
+		for k := 0; k < 3; k++ {
+			key := edgeKey(corners[t][k], corners[t][(k+1)%3])
+			edges[key] = append(edges[key], t)
+		}
+	}
+	// direction tells whether t runs along edge from its lower id, as 1 or -1
+	direction := func(t int, key [2]int32) int {
+		for k := 0; k < 3; k++ {
+			from, to := corners[t][k], corners[t][(k+1)%3]
+			if edgeKey(from, to) == key {
+				if from < to {
+					return 1
+				}
+				return -1
+			}
+		}
+		return 0
+	}
+
+	flipped := make([]bool, triangleCount)
+	visited := make([]bool, triangleCount)
+	var part, queue []int
+	for seed := range corners {
+		if !valid[seed] || visited[seed] {
+			continue
+		}
+
+		// Walk the part, making every neighbour run along the shared edge
+		// the other way
+		part = part[:0]
+		queue = append(queue[:0], seed)
+		visited[seed] = true
+		closed := true
+		for len(queue) > 0 {
+			t := queue[0]
+			queue = queue[1:]
+			part = append(part, t)
+			for k := 0; k < 3; k++ {
+				key := edgeKey(corners[t][k], corners[t][(k+1)%3])
+				shared := edges[key]
+				if len(shared) != 2 {
+					closed = false
+					continue
+				}
+				u := shared[0]
+				if u == t {
+					u = shared[1]
+				}
+				if visited[u] {
+					continue
+				}
+				effective := direction(t, key)
+				if flipped[t] {
+					effective = -effective
+				}
+				flipped[u] = direction(u, key) == effective
+				visited[u] = true
+				queue = append(queue, u)
+			}
+		}
+
+		flipAll := false
+		if closed {
+			var volume float64
+			for _, t := range part {
+				a, b, c := m.Triangle(t)
+				if flipped[t] {
+					b, c = c, b
+				}
+				volume += float64(m.Vertices[a].Dot(m.Vertices[b].Cross(m.Vertices[c])))
+			}
+			flipAll = volume < 0
+		} else {
+			flips := 0
+			for _, t := range part {
+				if flipped[t] {
+					flips++
+				}
+			}
+			flipAll = 2*flips > len(part)
+		}
+		if flipAll {
+			for _, t := range part {
+				flipped[t] = !flipped[t]
+			}
+		}
+	}
+
+	out := m
+	if m.Indices != nil {
+		out.Indices = append([]uint32(nil), m.Indices...)
+		for t, flip := range flipped {
+			if flip {
+				out.Indices[3*t+1], out.Indices[3*t+2] = out.Indices[3*t+2], out.Indices[3*t+1]
+			}
+		}
+		return out
+	}
+
+	out.Vertices = append([]mgl32.Vec3(nil), m.Vertices...)
+	out.Uvs = append(m.Uvs[:0:0], m.Uvs...)
+	out.Normals = append(m.Normals[:0:0], m.Normals...)
+	out.Colors = append(m.Colors[:0:0], m.Colors...)
+	out.Tangents = append(m.Tangents[:0:0], m.Tangents...)
+	out.Bitangents = append(m.Bitangents[:0:0], m.Bitangents...)
+	for t, flip := range flipped {
+		if flip {
+			i, j := 3*t+1, 3*t+2
+			swapValues(out.Vertices, i, j)
+			swapValues(out.Uvs, i, j)
+			swapValues(out.Normals, i, j)
+			swapValues(out.Colors, i, j)
+			swapValues(out.Tangents, i, j)
+			swapValues(out.Bitangents, i, j)
+		}
+	}
+	return out
+}
+
+func edgeKey(a, b int32) [2]int32 {
+	return [2]int32{min(a, b), max(a, b)}
+}
+
+// swapValues swaps two values of an attribute, if the mesh has it.
+func swapValues[T any](values []T, i, j int) {
+	if values != nil {
+		values[i], values[j] = values[j], values[i]
+	}
+}
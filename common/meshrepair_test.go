@@ -0,0 +1,104 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"reflect"
+	"testing"
+)
+
+func TestDropDegenerates(t *testing.T) {
+	// The degenerate and bad triangles are alone in their sub-mesh
+	m := tetrahedron(0, 1, 1, 0, 1, 9, 1, 0, 4)
+	m.SubMeshes = []SubMesh{{"a", 0, 12}, {"b", 12, 6}, {"c", 18, 3}}
+	m.Smoothing = []uint32{1, 1, 2, 2, 3, 4, 5}
+	for _, indexed := range []bool{true, false} {
+		in := m
+		if !indexed {
+			// Without the bad index, which can't be unindexed
+			in = tetrahedron(0, 1, 1, 1, 0, 4)
+			in.SubMeshes = []SubMesh{{"a", 0, 12}, {"b", 12, 3}, {"c", 15, 3}}
+			in.Smoothing = []uint32{1, 1, 2, 2, 3, 5}
+			in = UnindexMesh(in)
+		}
+		out := DropDegenerates(in)
+		if r := ValidateMesh(out); len(r.Degenerate) != 0 || len(r.BadIndices) != 0 {
+			t.Errorf("indexed %v: %v", indexed, &r)
+		}
+		if out.TriangleCount() != 5 {
+			t.Errorf("indexed %v: %d triangles, want 5", indexed, out.TriangleCount())
+		}
+		if want := []SubMesh{{"a", 0, 12}, {"c", 12, 3}}; !reflect.DeepEqual(out.SubMeshes, want) {
+			t.Errorf("indexed %v: sub-meshes %+v, want %+v", indexed, out.SubMeshes, want)
+		}
+		if want := []uint32{1, 1, 2, 2, 5}; !reflect.DeepEqual(out.Smoothing, want) {
+			t.Errorf("indexed %v: smoothing %v, want %v", indexed, out.Smoothing, want)
+		}
+	}
+}
+
+func TestWeldVertices(t *testing.T) {
+	// Every corner of the unindexed tetrahedron is written a little apart
+	m := UnindexMesh(tetrahedron())
+	m.Uvs = make([]mgl32.Vec2, len(m.Vertices))
+	for i := range m.Vertices {
+		m.Vertices[i] = m.Vertices[i].Add(mgl32.Vec3{float32(i%3) * 1e-5, 0, 0})
+	}
+
+	welded := WeldVertices(m, 1e-3)
+	if len(welded.Vertices) != 4 || welded.TriangleCount() != 4 {
+		t.Errorf("%d vertices and %d triangles, want 4 and 4", len(welded.Vertices), welded.TriangleCount())
+	}
+	if r := ValidateMesh(welded); !r.Valid() {
+		t.Errorf("welded: %v", &r)
+	}
+
+	// Exact matches only, or different texture coordinates, weld nothing
+	if exact := WeldVertices(m, 0); len(exact.Vertices) == 4 {
+		t.Error("a distance of 0 welded vertices apart")
+	}
+	m.Uvs[0] = mgl32.Vec2{0.5, 0.5}
+	if seam := WeldVertices(m, 1e-3); len(seam.Vertices) != 5 {
+		t.Errorf("%d vertices with a uv seam, want 5", len(seam.Vertices))
+	}
+}
+
+func TestUnifyWinding(t *testing.T) {
+	want := tetrahedron()
+	for _, tc := range []struct {
+		name    string
+		flipped []int
+	}{
+		{"one face", []int{3}},
+		{"two faces", []int{0, 2}},
+		// Closed parts face outwards even when most triangles don't
+		{"inside out", []int{0, 1, 2, 3}},
+	} {
+		m := tetrahedron()
+		for _, t := range tc.flipped {
+			m.Indices[3*t+1], m.Indices[3*t+2] = m.Indices[3*t+2], m.Indices[3*t+1]
+		}
+		for _, indexed := range []bool{true, false} {
+			in, wantOut := m, want
+			if !indexed {
+				in, wantOut = UnindexMesh(m), UnindexMesh(want)
+			}
+			got := UnifyWinding(in)
+			if !reflect.DeepEqual(triangleSet(got), triangleSet(wantOut)) {
+				t.Errorf("%s, indexed %v: got %v", tc.name, indexed, got.Indices)
+			}
+			if r := ValidateMesh(got); !r.Valid() {
+				t.Errorf("%s, indexed %v: %v", tc.name, indexed, &r)
+			}
+		}
+	}
+
+	// Open parts keep the winding most of their triangles have
+	strip := Mesh{
+		Indices:  []uint32{0, 1, 2, 2, 1, 3, 2, 4, 3},
+		Vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0}, {0, 2, 0}},
+	}
+	got := UnifyWinding(strip)
+	if want := []uint32{0, 1, 2, 2, 1, 3, 2, 3, 4}; !reflect.DeepEqual(got.Indices, want) {
+		t.Errorf("strip: got %v, want %v", got.Indices, want)
+	}
+}
@@ -0,0 +1,200 @@
+package common
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Edge is an edge between two vertices, identified by the index of the first
+// vertex at each of its ends, A < B.
+type Edge struct {
+	A, B uint32
+}
+
+// MeshReport lists the problems ValidateMesh found in a mesh. Triangles and
+// vertices are referred to by index.
+type MeshReport struct {
+	// MismatchedAttributes names the attributes that don't have one value
+	// per vertex.
+	MismatchedAttributes []string
+	// BadIndices lists the triangles referring to vertices that don't exist.
+	BadIndices []int
+	// Degenerate lists the triangles with a zero area.
+	Degenerate []int
+	// NaN lists the vertices with a NaN or infinite attribute.
+	NaN []int
+	// NonManifold lists the edges shared by more than two triangles.
+	NonManifold []Edge
+	// WindingConflicts lists the edges whose two triangles run along them in
+	// the same direction, which means one of them faces the wrong way.
+	WindingConflicts []Edge
+}
+
+// Valid reports whether no problem was found.
+func (r *MeshReport) Valid() bool {
+	return len(r.MismatchedAttributes) == 0 && len(r.BadIndices) == 0 &&
+		len(r.Degenerate) == 0 && len(r.NaN) == 0 &&
+		len(r.NonManifold) == 0 && len(r.WindingConflicts) == 0
+}
+
+func (r *MeshReport) String() string {
+	if r.Valid() {
+		return "valid mesh"
+	}
+	var problems []string
+	if len(r.MismatchedAttributes) > 0 {
+		problems = append(problems, "mismatched "+strings.Join(r.MismatchedAttributes, ", "))
+	}
+	count := func(n int, what string) {
+		if n > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s", n, what))
+		}
+	}
+	count(len(r.BadIndices), "triangles with bad indices")
+	count(len(r.Degenerate), "degenerate triangles")
+	count(len(r.NaN), "vertices with NaNs")
+	count(len(r.NonManifold), "non-manifold edges")
+	count(len(r.WindingConflicts), "edges with conflicting winding")
+	return strings.Join(problems, ", ")
+}
+
+// ValidateMesh checks m for data that would draw wrong or break mesh
+// processing. Vertices at the same position are considered the same for
+// edges, so indexed and non-indexed meshes give the same report.
+func ValidateMesh(m Mesh) MeshReport {
+	var r MeshReport
+	n := len(m.Vertices)
+	for _, attribute := range []struct {
+		name   string
+		length int
+		isNil  bool
+	}{
+		{"uvs", len(m.Uvs), m.Uvs == nil},
+		{"normals", len(m.Normals), m.Normals == nil},
+		{"colors", len(m.Colors), m.Colors == nil},
+		{"tangents", len(m.Tangents), m.Tangents == nil},
+		{"bitangents", len(m.Bitangents), m.Bitangents == nil},
+	} {
+		if !attribute.isNil && attribute.length != n {
+			r.MismatchedAttributes = append(r.MismatchedAttributes, attribute.name)
+		}
+	}
+
+	for i := range m.Vertices {
+		if !m.isFiniteVertex(i) {
+			r.NaN = append(r.NaN, i)
+		}
+	}
+
+	// Direction of use of every edge, counting the forward ones
+	type edgeUse struct {
+		count, forward int
+	}
+	ids, firsts := positionIDs(m.Vertices)
+	edges := make(map[[2]int32]*edgeUse)
+	for t := 0; t < m.TriangleCount(); t++ {
+		a, b, c := m.Triangle(t)
+		if int(a) >= n || int(b) >= n || int(c) >= n {
+			r.BadIndices = append(r.BadIndices, t)
+			continue
+		}
+		if isDegenerate(m.Vertices[a], m.Vertices[b], m.Vertices[c]) {
+			r.Degenerate = append(r.Degenerate, t)
+			continue
+		}
+		corners := [3]int32{ids[a], ids[b], ids[c]}
+		for k := range corners {
+			from, to := corners[k], corners[(k+1)%3]
+			key := edgeKey(from, to)
+			use := edges[key]
+			if use == nil {
+				use = &edgeUse{}
+				edges[key] = use
+			}
+			use.count++
+			if from < to {
+				use.forward++
+			}
+		}
+	}
+
+	for key, use := range edges {
+		edge := Edge{A: firsts[key[0]], B: firsts[key[1]]}
+		if use.count > 2 {
+			r.NonManifold = append(r.NonManifold, edge)
+		} else if use.count == 2 && use.forward != 1 {
+			r.WindingConflicts = append(r.WindingConflicts, edge)
+		}
+	}
+	sortEdges(r.NonManifold)
+	sortEdges(r.WindingConflicts)
+	return r
+}
+
+// isFiniteVertex reports whether every attribute of vertex i is a number.
+func (m *Mesh) isFiniteVertex(i int) bool {
+	finite := func(values []float32) bool {
+		for _, f := range values {
+			if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+				return false
+			}
+		}
+		return true
+	}
+	if !finite(m.Vertices[i][:]) {
+		return false
+	}
+	if i < len(m.Uvs) && !finite(m.Uvs[i][:]) {
+		return false
+	}
+	if i < len(m.Normals) && !finite(m.Normals[i][:]) {
+		return false
+	}
+	if i < len(m.Colors) && !finite(m.Colors[i][:]) {
+		return false
+	}
+	if i < len(m.Tangents) && !finite(m.Tangents[i][:]) {
+		return false
+	}
+	return i >= len(m.Bitangents) || finite(m.Bitangents[i][:])
+}
+
+// isDegenerate reports whether a triangle has no area, or so little compared
+// to its size that its normal is meaningless. Triangles with NaN corners are
+// degenerate too.
+func isDegenerate(p0, p1, p2 mgl32.Vec3) bool {
+	e1, e2, e3 := p1.Sub(p0), p2.Sub(p0), p2.Sub(p1)
+	longest := max(e1.LenSqr(), e2.LenSqr(), e3.LenSqr())
+	area := e1.Cross(e2).Len()
+	return !(area > 1e-6*longest)
+}
+
+// positionIDs numbers the distinct positions of vertices. It returns the
+// number of each vertex's position, and the first vertex with each number.
+func positionIDs(vertices []mgl32.Vec3) ([]int32, []uint32) {
+	ids := make([]int32, len(vertices))
+	var firsts []uint32
+	seen := make(map[mgl32.Vec3]int32)
+	for i, position := range vertices {
+		id, found := seen[position]
+		if !found {
+			id = int32(len(firsts))
+			seen[position] = id
+			firsts = append(firsts, uint32(i))
+		}
+		ids[i] = id
+	}
+	return ids, firsts
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].A != edges[j].A {
+			return edges[i].A < edges[j].A
+		}
+		return edges[i].B < edges[j].B
+	})
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// tetrahedron returns a closed, indexed tetrahedron whose triangles face
+// outwards, followed by the extra triangles.
+func tetrahedron(extra ...uint32) Mesh {
+	return Mesh{
+		Indices:  append([]uint32{0, 2, 1, 0, 1, 3, 0, 3, 2, 1, 2, 3}, extra...),
+		Vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0, -1, 0.5}},
+	}
+}
+
+func TestValidateMesh(t *testing.T) {
+	flipped := tetrahedron()
+	flipped.Indices[10], flipped.Indices[11] = flipped.Indices[11], flipped.Indices[10]
+	nan := tetrahedron()
+	nan.Vertices[4] = mgl32.Vec3{float32(math.NaN()), 0, 0}
+	mismatched := tetrahedron()
+	mismatched.Normals = make([]mgl32.Vec3, 2)
+
+	for _, tc := range []struct {
+		name string
+		m    Mesh
+		want MeshReport
+	}{
+		{"tetrahedron", tetrahedron(), MeshReport{}},
+		// Duplicate vertices are the same vertex for edges
+		{"unindexed", UnindexMesh(tetrahedron()), MeshReport{}},
+		{"degenerate", tetrahedron(0, 1, 1, 3, 3, 3), MeshReport{Degenerate: []int{4, 5}}},
+		{"bad index", tetrahedron(0, 1, 9), MeshReport{BadIndices: []int{4}}},
+		// A fin on the edge from vertex 0 to vertex 1
+		{"non-manifold", tetrahedron(1, 0, 4), MeshReport{NonManifold: []Edge{{0, 1}}}},
+		{"flipped face", flipped, MeshReport{WindingConflicts: []Edge{{1, 2}, {1, 3}, {2, 3}}}},
+		{"NaN", nan, MeshReport{NaN: []int{4}}},
+		{"mismatched attributes", mismatched, MeshReport{MismatchedAttributes: []string{"normals"}}},
+	} {
+		r := ValidateMesh(tc.m)
+		if !reflect.DeepEqual(r, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, r, tc.want)
+		}
+		if r.Valid() != reflect.DeepEqual(tc.want, MeshReport{}) {
+			t.Errorf("%s: valid is %v for %v", tc.name, r.Valid(), &r)
+		}
+	}
+}
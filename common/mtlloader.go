@@ -0,0 +1,206 @@
+package common
+
+import (
+	"bufio"
+	"github.com/go-gl/mathgl/mgl32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Material is one "newmtl" entry of an MTL material library. Texture maps
+// are file names as written in the library, usually relative to it.
+type Material struct {
+	Name string
+
+	Ambient   mgl32.Vec3 // Ka
+	Diffuse   mgl32.Vec3 // Kd
+	Specular  mgl32.Vec3 // Ks
+	Shininess float32    // Ns
+	Dissolve  float32    // d, or 1 - Tr
+	Illum     int        // illum
+
+	DiffuseMap  string // map_Kd
+	BumpMap     string // map_Bump or bump
+	SpecularMap string // map_Ks
+
+	// Metallic-roughness parameters of glTF materials. Diffuse, Dissolve and
+	// DiffuseMap are also set from the base color so that either set of
+	// fields can be used. MTL files leave these zero.
+	BaseColor   mgl32.Vec4
+	Metallic    float32
+	Roughness   float32
+	Emissive    mgl32.Vec3
+	AlphaMode   string // OPAQUE, MASK or BLEND
+	AlphaCutoff float32
+	DoubleSided bool
+
+	BaseColorMap         string
+	MetallicRoughnessMap string // metalness in blue, roughness in green
+	NormalMap            string
+	OcclusionMap         string
+	EmissiveMap          string
+}
+
+// ReadMTL parses an MTL material library from r and returns its materials by
+// name. name is only used in error messages.
+func ReadMTL(r io.Reader, name string) (map[string]*Material, error) {
+	materials := make(map[string]*Material)
+	var current *Material
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		// Split like restOfLine, so that names start after as many fields
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r < utf8.RuneSelf && isSpace(byte(r))
+		})
+		// Skip blank lines and comments
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		fail := func(token string, err error) error {
+			return &OBJError{File: name, Line: line, Token: token, Err: err}
+		}
+
+		if fields[0] == "newmtl" {
+			if len(fields) < 2 {
+				return nil, fail(fields[0], ErrOBJSyntax)
+			}
+			current = &Material{Name: restOfLine(text, 1), Dissolve: 1}
+			materials[current.Name] = current
+			continue
+		}
+		if current == nil {
+			// Statements before the first newmtl have nothing to apply to
+			continue
+		}
+
+		var token string
+		var err error
+		switch fields[0] {
+		case "Ka":
+			token, err = parseFloats(current.Ambient[:], fields[1:])
+		case "Kd":
+			token, err = parseFloats(current.Diffuse[:], fields[1:])
+		case "Ks":
+			token, err = parseFloats(current.Specular[:], fields[1:])
+		case "Ns":
+			token, err = parseMaterialFloat(&current.Shininess, fields[1:])
+		case "d":
+			token, err = parseMaterialFloat(&current.Dissolve, fields[1:])
+		case "Tr":
+			var transparency float32
+			token, err = parseMaterialFloat(&transparency, fields[1:])
+			current.Dissolve = 1 - transparency
+		case "illum":
+			if len(fields) < 2 {
+				token, err = fields[0], ErrOBJSyntax
+			} else if current.Illum, err = strconv.Atoi(fields[1]); err != nil {
+				token, err = fields[1], ErrOBJSyntax
+			}
+		case "map_Kd":
+			token, err = parseMapName(&current.DiffuseMap, fields, text)
+		case "map_Bump", "map_bump", "bump":
+			token, err = parseMapName(&current.BumpMap, fields, text)
+		case "map_Ks":
+			token, err = parseMapName(&current.SpecularMap, fields, text)
+		}
+		if err != nil {
+			return nil, fail(token, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &OBJError{File: name, Line: line + 1, Err: err}
+	}
+
+	return materials, nil
+}
+
+// parseFloats fills dst from fields. Missing trailing values are left untouched
+// and extra ones are ignored. On failure the offending token is returned.
+func parseFloats(dst []float32, fields []string) (string, error) {
+	if len(fields) == 0 {
+		return "", ErrOBJSyntax
+	}
+	for i := 0; i < len(dst) && i < len(fields); i++ {
+		f, err := strconv.ParseFloat(fields[i], 32)
+		if err != nil {
+			return fields[i], ErrOBJSyntax
+		}
+		dst[i] = float32(f)
+	}
+	return "", nil
+}
+
+func parseMaterialFloat(dst *float32, fields []string) (string, error) {
+	var value [1]float32
+	if token, err := parseFloats(value[:], fields); err != nil {
+		return token, err
+	}
+	*dst = value[0]
+	return "", nil
+}
+
+// mapOptionArgs is the number of values taken by each texture map option.
+// Negative counts are the maximum of a variable number of numbers.
+var mapOptionArgs = map[string]int{
+	"-blendu":  1,
+	"-blendv":  1,
+	"-bm":      1,
+	"-boost":   1,
+	"-cc":      1,
+	"-clamp":   1,
+	"-imfchan": 1,
+	"-mm":      2,
+	"-o":       -3,
+	"-s":       -3,
+	"-t":       -3,
+	"-texres":  1,
+	"-type":    1,
+}
+
+// parseMapName stores the file name of a texture map statement, which comes
+// after any option such as "-bm 1.0" or "-s 1 1 1" and runs to the end of
+// line, spaces included.
+func parseMapName(dst *string, fields []string, line string) (string, error) {
+	i := 1
+	for i < len(fields) {
+		count, ok := mapOptionArgs[fields[i]]
+		if !ok {
+			break
+		}
+		i++
+		if count > 0 {
+			i += count
+			continue
+		}
+		// -o, -s and -t take one to three numbers
+		for n := 0; n < -count && i < len(fields); n++ {
+			if _, err := strconv.ParseFloat(fields[i], 32); err != nil {
+				break
+			}
+			i++
+		}
+	}
+	if i >= len(fields) {
+		return fields[0], ErrOBJSyntax
+	}
+	*dst = restOfLine(line, i)
+	return "", nil
+}
+
+// LoadMTLFile opens and parses the MTL material library at path.
+func LoadMTLFile(path string) (map[string]*Material, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadMTL(f, path)
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadMTLNames(t *testing.T) {
+	// Names and file names keep their inner spaces, repeated or not, and
+	// lose the ones around them
+	const mtl = "newmtl  red  paint \n" +
+		"map_Kd -s 1 1 1 -bm 0.5 my  textures/red paint.png\t\r\n" +
+		"map_Bump -clamp on bump map.png\n" +
+		"newmtl blue\n" +
+		"map_Ks -o 0.5 spec.tga\n"
+	materials, err := ReadMTL(strings.NewReader(mtl), "names.mtl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	red, blue := materials["red  paint"], materials["blue"]
+	if len(materials) != 2 || red == nil || blue == nil {
+		t.Fatalf("got materials %v", materials)
+	}
+	for _, tc := range []struct{ got, want string }{
+		{red.Name, "red  paint"},
+		{red.DiffuseMap, "my  textures/red paint.png"},
+		{red.BumpMap, "bump map.png"},
+		{blue.SpecularMap, "spec.tga"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+
+	// Options without a file name after them
+	_, err = ReadMTL(strings.NewReader("newmtl a\nmap_Kd -s 1 1 1\n"), "bad.mtl")
+	want := OBJError{File: "bad.mtl", Line: 2, Token: "map_Kd", Err: ErrOBJSyntax}
+	if e, ok := err.(*OBJError); !ok || *e != want {
+		t.Errorf("got %v, want %v", err, &want)
+	}
+}
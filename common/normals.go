@@ -0,0 +1,131 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// NormalWeighting selects how the normals of the faces around a vertex are
+// combined into a smooth vertex normal.
+type NormalWeighting int
+
+const (
+	// WeightByArea favours large faces.
+	WeightByArea NormalWeighting = iota
+	// WeightByAngle favours faces with a wide corner at the vertex, which
+	// doesn't depend on how the surface was triangulated.
+	WeightByAngle
+)
+
+// NormalOptions controls GenerateNormals.
+type NormalOptions struct {
+	// Smooth shares normals between faces meeting at a vertex. Otherwise
+	// every face gets its own flat normal.
+	Smooth    bool
+	Weighting NormalWeighting
+	// CreaseAngle, in degrees, keeps an edge sharp when its faces meet at a
+	// larger angle. 0 smooths regardless of the angle.
+	CreaseAngle float32
+}
+
+// GenerateNormals returns a copy of m with new normals computed from its
+// triangles. When m has smoothing groups, only faces of the same non-zero
+// group are smoothed together and group 0 stays flat. Faces are never
+// reordered, but an indexed mesh is re-indexed since hard edges need their
+// own vertices.
+func GenerateNormals(m Mesh, opts NormalOptions) Mesh {
+	indexed := m.Indices != nil
+	out := UnindexMesh(m)
+	triangleCount := out.TriangleCount()
+
+	// Normal of every face, with a length of twice its area
+	faceNormals := make([]mgl32.Vec3, triangleCount)
+	for t := range faceNormals {
+		p0, p1, p2 := out.Vertices[3*t], out.Vertices[3*t+1], out.Vertices[3*t+2]
+		faceNormals[t] = p1.Sub(p0).Cross(p2.Sub(p0))
+	}
+
+	out.Normals = make([]mgl32.Vec3, len(out.Vertices))
+	// Tangents no longer match the new normals
+	out.Tangents = nil
+	out.Bitangents = nil
+	if !opts.Smooth {
+		for i := range out.Normals {
+			out.Normals[i] = normalize(faceNormals[i/3])
+		}
+		if indexed {
+			return IndexMesh(out)
+		}
+		return out
+	}
+
+	// Gather the corners sitting at the same position in the same smoothing group
+	type cornerKey struct {
+		position  mgl32.Vec3
+		smoothing uint32
+	}
+	corners := make(map[cornerKey][]int)
+	for i, position := range out.Vertices {
+		key := cornerKey{position: position}
+		if out.Smoothing != nil {
+			key.smoothing = out.Smoothing[i/3]
+			if key.smoothing == 0 {
+				// Flat : don't share with anything
+				out.Normals[i] = normalize(faceNormals[i/3])
+				continue
+			}
+		}
+		corners[key] = append(corners[key], i)
+	}
+
+	minCos := float32(-1)
+	if opts.CreaseAngle > 0 {
+		minCos = float32(math.Cos(float64(mgl32.DegToRad(opts.CreaseAngle))))
+	}
+	for _, shared := range corners {
+		for _, i := range shared {
+			faceNormal := normalize(faceNormals[i/3])
+			var sum mgl32.Vec3
+			for _, j := range shared {
+				other := faceNormals[j/3]
+				if j != i && normalize(other).Dot(faceNormal) < minCos {
+					continue
+				}
+				if opts.Weighting == WeightByAngle {
+					sum = sum.Add(normalize(other).Mul(cornerAngle(out.Vertices, j)))
+				} else {
+					sum = sum.Add(other)
+				}
+			}
+			out.Normals[i] = normalize(sum)
+		}
+	}
+
+	if indexed {
+		return IndexMesh(out)
+	}
+	return out
+}
+
+// cornerAngle returns the angle, in radians, of triangle corner i of a
+// non-indexed vertex list.
+func cornerAngle(vertices []mgl32.Vec3, i int) float32 {
+	first, corner := i-i%3, i%3
+	p := vertices[i]
+	a := vertices[first+(corner+1)%3].Sub(p)
+	b := vertices[first+(corner+2)%3].Sub(p)
+	if a.Len() == 0 || b.Len() == 0 {
+		return 0
+	}
+	cos := mgl32.Clamp(a.Normalize().Dot(b.Normalize()), -1, 1)
+	return float32(math.Acos(float64(cos)))
+}
+
+// normalize is Vec3.Normalize that leaves zero vectors alone instead of
+// returning NaNs.
+func normalize(v mgl32.Vec3) mgl32.Vec3 {
+	if v.Len() == 0 {
+		return v
+	}
+	return v.Normalize()
+}
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"strings"
+	"testing"
+)
+
+// cubeOBJ returns a cube of side 2 centered on the origin, made of quads
+// without normals, with statement before the faces. The top face comes
+// last, after top.
+func cubeOBJ(statement, top string) string {
+	return fmt.Sprintf(`v -1 -1 -1
+v 1 -1 -1
+v 1 1 -1
+v -1 1 -1
+v -1 -1 1
+v 1 -1 1
+v 1 1 1
+v -1 1 1
+%s
+f 1 4 3 2
+f 5 6 7 8
+f 1 2 6 5
+f 2 3 7 6
+f 4 1 5 8
+%s
+f 4 8 7 3
+`, statement, top)
+}
+
+// readCube reads cubeOBJ indexed, with normals generated by opts.
+func readCube(t *testing.T, statement, top string, opts NormalOptions) Mesh {
+	t.Helper()
+	m, err := ReadOBJ(strings.NewReader(cubeOBJ(statement, top)), "cube.obj", &OBJOptions{Index: true, Normals: &opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < m.TriangleCount(); i++ {
+		a, b, c := m.Triangle(i)
+		for _, v := range [3]uint32{a, b, c} {
+			// Every normal points out of the cube
+			if m.Normals[v].Dot(m.Vertices[v]) <= 0 {
+				t.Errorf("%s %s %+v: vertex %v has normal %v", statement, top, opts, m.Vertices[v], m.Normals[v])
+			}
+		}
+	}
+	return m
+}
+
+// isAxis tells whether n is a unit vector along one of the axes.
+func isAxis(n mgl32.Vec3) bool {
+	zeros := 0
+	for _, c := range n {
+		if c == 0 {
+			zeros++
+		} else if c != 1 && c != -1 {
+			return false
+		}
+	}
+	return zeros == 2
+}
+
+func TestGenerateNormalsCube(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		statement string
+		opts      NormalOptions
+		vertices  int
+		// Normals along the axes, one per face, rather than averaged
+		hard bool
+	}{
+		{"flat", "", NormalOptions{}, 24, true},
+		{"crease", "", NormalOptions{Smooth: true, CreaseAngle: 60}, 24, true},
+		{"crease in a smoothing group", "s 1", NormalOptions{Smooth: true, CreaseAngle: 60}, 24, true},
+		{"wide crease", "s 1", NormalOptions{Smooth: true, CreaseAngle: 100, Weighting: WeightByAngle}, 8, false},
+		{"no groups", "", NormalOptions{Smooth: true, Weighting: WeightByAngle}, 8, false},
+		{"smoothing group", "s 1", NormalOptions{Smooth: true, Weighting: WeightByAngle}, 8, false},
+	} {
+		m := readCube(t, tc.statement, "", tc.opts)
+		if len(m.Vertices) != tc.vertices {
+			t.Errorf("%s: %d vertices, want %d", tc.name, len(m.Vertices), tc.vertices)
+		}
+		for i, n := range m.Normals {
+			// Averaging the three faces of a corner by their angle, 90° each,
+			// points the normal along the diagonal
+			diagonal := m.Vertices[i].Normalize()
+			if tc.hard && !isAxis(n) || !tc.hard && !near(n[:], diagonal[:]) {
+				t.Errorf("%s: vertex %v has normal %v", tc.name, m.Vertices[i], n)
+			}
+		}
+	}
+}
+
+func TestGenerateNormalsWeighting(t *testing.T) {
+	// Each corner has one or two triangles of each face depending on how the
+	// quads were split, which only weighting by area notices
+	m := readCube(t, "s 1", "", NormalOptions{Smooth: true, Weighting: WeightByArea})
+	skewed := 0
+	for i, n := range m.Normals {
+		if diagonal := m.Vertices[i].Normalize(); !near(n[:], diagonal[:]) {
+			skewed++
+		}
+	}
+	if skewed == 0 {
+		t.Error("weighting by area gave the same normals as weighting by angle")
+	}
+}
+
+func TestGenerateNormalsGroups(t *testing.T) {
+	// The top face is in its own group, and the others are smoothed
+	// together, whether the top face is flat or smooth
+	for _, top := range []string{"s off", "s 2"} {
+		m := readCube(t, "s 1", top, NormalOptions{Smooth: true, Weighting: WeightByAngle})
+		// 8 smooth corners, and 4 for the top face
+		if len(m.Vertices) != 12 {
+			t.Errorf("top face %q: %d vertices, want 12", top, len(m.Vertices))
+		}
+		for i := 10; i < 12; i++ {
+			a, b, c := m.Triangle(i)
+			for _, v := range [3]uint32{a, b, c} {
+				if m.Normals[v] != (mgl32.Vec3{0, 1, 0}) {
+					t.Errorf("top face %q: vertex %v has normal %v", top, m.Vertices[v], m.Normals[v])
+				}
+			}
+		}
+		if m.Smoothing[11] != 0 && top == "s off" || m.Smoothing[0] != 1 {
+			t.Errorf("top face %q: smoothing groups %v", top, m.Smoothing)
+		}
+	}
+}
@@ -1,86 +1,626 @@
 package common
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
 	"io"
-	"log"
+	"math"
 	"os"
-	"strings"
+	"path/filepath"
+	"strconv"
+	"sync"
 )
 
-func LoadOBJ(path string, outVertices []mgl32.Vec3, outUvs []mgl32.Vec2, outNormals []mgl32.Vec3) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, bool) {
-	var vertexIndices, uvIndices, normalIndices []uint32
-	var tempVertices, tempNormals []mgl32.Vec3
-	var tempUvs []mgl32.Vec2
+// Errors wrapped by OBJError.
+var (
+	ErrOBJSyntax = errors.New("malformed statement")
+	ErrOBJFace   = errors.New("unsupported face format")
+	ErrOBJIndex  = errors.New("index out of range")
+)
 
-	f, err := os.Open(path)
-	if err != nil {
-		log.Fatal(err)
+// OBJOptions controls how ReadOBJ builds its Mesh. A nil *OBJOptions is
+// the same as the zero value.
+type OBJOptions struct {
+	// Index merges identical vertices and fills Mesh.Indices, see IndexMesh.
+	Index bool
+	// Normals, if not nil, computes normals for files that have none.
+	Normals *NormalOptions
+	// FlipV converts V texture coordinates for the texture loader in use.
+	FlipV VFlip
+	// Workers, when more than 1, reads the whole file in memory and parses
+	// that many parts of it concurrently. The result is the same as parsing
+	// it sequentially.
+	Workers int
+}
+
+// OBJError reports where in an OBJ file parsing failed.
+type OBJError struct {
+	File  string
+	Line  int
+	Token string
+	Err   error
+}
+
+func (e *OBJError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
 	}
-	defer f.Close()
+	return fmt.Sprintf("%s:%d: %q: %v", e.File, e.Line, e.Token, e.Err)
+}
 
-	for {
-		var lineHeader string
-		// read the first word of the line
-		_, err := fmt.Fscanf(f, "%s", &lineHeader)
-		if err == io.EOF {
-			break // EOF = End Of File. Quit the loop.
-		}
-
-		// else : parse lineHeader
-
-		if strings.Compare(string(lineHeader), "v") == 0 {
-			var vertex mgl32.Vec3
-			fmt.Fscanf(f, "%f %f %f\n", &vertex[0], &vertex[1], &vertex[2])
-			tempVertices = append(tempVertices, vertex)
-		} else if strings.Compare(string(lineHeader), "vt") == 0 {
-			var uv mgl32.Vec2
-			fmt.Fscanf(f, "%f %f\n", &uv[0], &uv[1])
-			uv[1] = -uv[1] // Invert V coordinate since we will only use DDS texture, which are inverted. Remove if you want to use TGA or BMP loaders.
-			tempUvs = append(tempUvs, uv)
-		} else if strings.Compare(string(lineHeader), "vn") == 0 {
-			var normal mgl32.Vec3
-			fmt.Fscanf(f, "%f %f %f\n", &normal[0], &normal[1], &normal[2])
-			tempNormals = append(tempNormals, normal)
-		} else if strings.Compare(string(lineHeader), "f") == 0 {
-			//var vertex1, vertex2, vertex3 string
-			var vertexIndex, uvIndex, normalIndex [3]uint32
-			matches, _ := fmt.Fscanf(f, "%d/%d/%d %d/%d/%d %d/%d/%d\n", &vertexIndex[0], &uvIndex[0], &normalIndex[0], &vertexIndex[1], &uvIndex[1], &normalIndex[1], &vertexIndex[2], &uvIndex[2], &normalIndex[2])
-			if matches != 9 {
-				fmt.Println("File can't be read by our simple parser :-( Try exporting with other options")
-				return []mgl32.Vec3{}, []mgl32.Vec2{}, []mgl32.Vec3{}, false
+func (e *OBJError) Unwrap() error {
+	return e.Err
+}
+
+// ReadOBJ parses an OBJ file from r. name is only used in error messages.
+func ReadOBJ(r io.Reader, name string, opts *OBJOptions) (Mesh, error) {
+	model, err := ReadOBJModel(r, name, opts)
+	return model.Mesh, err
+}
+
+// ReadOBJModel is like ReadOBJ but also returns the objects and groups the
+// triangles belong to.
+func ReadOBJModel(r io.Reader, name string, opts *OBJOptions) (Model, error) {
+	if opts == nil {
+		opts = &OBJOptions{}
+	}
+	if opts.Workers > 1 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return Model{}, err
+		}
+		return readOBJParallel(data, name, opts)
+	}
+
+	p := newOBJParser(name, opts)
+	c := newOBJChunk(name, opts, 1)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxOBJLine)
+	for c.err == nil && scanner.Scan() {
+		c.parseLine(scanner.Bytes())
+
+		// Resolve what was read every now and then to keep memory in check
+		if c.line-c.firstLine >= objChunkLines {
+			if err := p.apply(c); err != nil {
+				return Model{}, err
 			}
-			vertexIndices = append(vertexIndices, vertexIndex[0])
-			vertexIndices = append(vertexIndices, vertexIndex[1])
-			vertexIndices = append(vertexIndices, vertexIndex[2])
-			uvIndices = append(uvIndices, uvIndex[0])
-			uvIndices = append(uvIndices, uvIndex[1])
-			uvIndices = append(uvIndices, uvIndex[2])
-			normalIndices = append(normalIndices, normalIndex[0])
-			normalIndices = append(normalIndices, normalIndex[1])
-			normalIndices = append(normalIndices, normalIndex[2])
+			c.reset(c.line + 1)
 		}
 	}
+	if err := p.apply(c); err != nil {
+		return Model{}, err
+	}
+	if err := scanner.Err(); err != nil {
+		return Model{}, &OBJError{File: name, Line: c.line + 1, Err: err}
+	}
+	return p.finish(), nil
+}
+
+// readOBJParallel splits data at line boundaries, parses each part in its own
+// goroutine, then resolves the parts in order like the sequential path does.
+func readOBJParallel(data []byte, name string, opts *OBJOptions) (Model, error) {
+	chunks := make([]*objChunk, opts.Workers)
+	var wg sync.WaitGroup
+	start, line := 0, 1
+	for i := range chunks {
+		end := len(data)
+		if i < len(chunks)-1 {
+			end = start + (len(data)-start)/(len(chunks)-i)
+			if next := bytes.IndexByte(data[end:], '\n'); next >= 0 {
+				end += next + 1
+			} else {
+				end = len(data)
+			}
+		}
+
+		chunks[i] = newOBJChunk(name, opts, line)
+		wg.Add(1)
+		go func(c *objChunk, part []byte) {
+			defer wg.Done()
+			c.parseLines(part)
+		}(chunks[i], data[start:end])
+
+		line += bytes.Count(data[start:end], []byte{'\n'})
+		start = end
+	}
+	wg.Wait()
+
+	p := newOBJParser(name, opts)
+	for _, c := range chunks {
+		if err := p.apply(c); err != nil {
+			return Model{}, err
+		}
+	}
+	return p.finish(), nil
+}
+
+// maxOBJLine bounds the length of a single line, which only matters for faces
+// with thousands of vertices.
+const maxOBJLine = 16 * 1024 * 1024
+
+// objChunkLines is how many lines the sequential path reads before resolving them.
+const objChunkLines = 64 * 1024
+
+// objCorner holds the indices of one face corner. Once resolved they are
+// 0-based, -1 meaning absent. As read, they are the 1-based or negative
+// values from the file, 0 meaning absent.
+type objCorner struct {
+	vertex, uv, normal int32
+}
+
+// objFace is a face as read, before its indices are resolved. The counts are
+// the number of elements the chunk had read before the face.
+type objFace struct {
+	line                   int
+	first, count           int
+	vertices, uvs, normals int
+}
+
+// objStatement is any other statement that changes how the following faces
+// are stored, applied once the faces before it are.
+type objStatement struct {
+	face      int // number of faces of the chunk before the statement
+	keyword   string
+	values    []string
+	smoothing uint32
+}
+
+// objChunk holds what was read from consecutive lines of an OBJ file. Faces
+// can't be resolved on their own since negative indices depend on every line
+// before the chunk.
+type objChunk struct {
+	name  string
+	flipV VFlip
+
+	firstLine, line   int
+	vertices, normals []mgl32.Vec3
+	uvs               []mgl32.Vec2
+	faces             []objFace
+	corners           []objCorner
+	statements        []objStatement
+
+	// err is the first error found in the chunk. Everything read before it
+	// is still resolved, so errors come out in file order.
+	err    error
+	fields [][]byte
+}
+
+func newOBJChunk(name string, opts *OBJOptions, firstLine int) *objChunk {
+	c := &objChunk{name: name, flipV: opts.FlipV}
+	c.reset(firstLine)
+	return c
+}
+
+// reset empties the chunk, keeping its buffers, to read from firstLine on.
+func (c *objChunk) reset(firstLine int) {
+	c.firstLine = firstLine
+	c.line = firstLine - 1
+	c.vertices = c.vertices[:0]
+	c.normals = c.normals[:0]
+	c.uvs = c.uvs[:0]
+	c.faces = c.faces[:0]
+	c.corners = c.corners[:0]
+	c.statements = c.statements[:0]
+	c.err = nil
+}
+
+func (c *objChunk) fail(token []byte, err error) {
+	c.err = &OBJError{File: c.name, Line: c.line, Token: string(token), Err: err}
+}
+
+// parseLines reads every line of data, stopping at the first error.
+func (c *objChunk) parseLines(data []byte) {
+	for len(data) > 0 && c.err == nil {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		c.parseLine(line)
+	}
+}
+
+func (c *objChunk) parseLine(line []byte) {
+	c.line++
+	c.fields = splitFields(c.fields, line)
+	fields := c.fields
+	// Skip blank lines and comments
+	if len(fields) == 0 || fields[0][0] == '#' {
+		return
+	}
+
+	switch string(fields[0]) {
+	case "v":
+		var vertex mgl32.Vec3
+		if c.parseVector(vertex[:], fields) {
+			c.vertices = append(c.vertices, vertex)
+		}
+	case "vt":
+		var uv mgl32.Vec2
+		if c.parseVector(uv[:], fields) {
+			c.uvs = append(c.uvs, c.flipV.Apply(uv))
+		}
+	case "vn":
+		var normal mgl32.Vec3
+		if c.parseVector(normal[:], fields) {
+			c.normals = append(c.normals, normal)
+		}
+	case "f":
+		c.parseFace(fields)
+	case "mtllib":
+		if len(fields) < 2 {
+			c.fail(fields[0], ErrOBJSyntax)
+			return
+		}
+		statement := objStatement{face: len(c.faces), keyword: "mtllib"}
+		for _, value := range fields[1:] {
+			statement.values = append(statement.values, string(value))
+		}
+		c.statements = append(c.statements, statement)
+	case "usemtl":
+		if len(fields) < 2 {
+			c.fail(fields[0], ErrOBJSyntax)
+			return
+		}
+		c.parseName(fields[0], line)
+	case "o", "g":
+		c.parseName(fields[0], line)
+	case "s":
+		if len(fields) < 2 {
+			c.fail(fields[0], ErrOBJSyntax)
+			return
+		}
+		var smoothing uint32
+		if string(fields[1]) != "off" {
+			value, ok := parseInt(fields[1])
+			if !ok || value < 0 || value > math.MaxUint32 {
+				c.fail(fields[1], ErrOBJSyntax)
+				return
+			}
+			smoothing = uint32(value)
+		}
+		c.statements = append(c.statements, objStatement{face: len(c.faces), keyword: "s", smoothing: smoothing})
+	}
+}
+
+// parseName records a statement naming a material, object or group. Names
+// run to the end of the line, spaces included.
+func (c *objChunk) parseName(keyword, line []byte) {
+	c.statements = append(c.statements, objStatement{
+		face:    len(c.faces),
+		keyword: string(keyword),
+		values:  []string{restOfLine(string(line), 1)},
+	})
+}
+
+// parseVector fills dst from the values following the statement keyword.
+// Missing trailing values are left untouched and extra ones are ignored.
+func (c *objChunk) parseVector(dst []float32, fields [][]byte) bool {
+	if len(fields) < 2 {
+		c.fail(fields[0], ErrOBJSyntax)
+		return false
+	}
+	for i := 0; i < len(dst) && i+1 < len(fields); i++ {
+		f, ok := parseFloat(fields[i+1])
+		if !ok {
+			c.fail(fields[i+1], ErrOBJSyntax)
+			return false
+		}
+		dst[i] = f
+	}
+	return true
+}
+
+func (c *objChunk) parseFace(fields [][]byte) {
+	if len(fields) < 4 {
+		// The face itself is what's wrong, not any of its corners
+		c.fail(bytes.Join(fields, []byte(" ")), ErrOBJFace)
+		return
+	}
+	face := objFace{
+		line:     c.line,
+		first:    len(c.corners),
+		count:    len(fields) - 1,
+		vertices: len(c.vertices),
+		uvs:      len(c.uvs),
+		normals:  len(c.normals),
+	}
+	for _, corner := range fields[1:] {
+		raw, err := parseCorner(corner)
+		if err != nil {
+			c.corners = c.corners[:face.first]
+			c.fail(corner, err)
+			return
+		}
+		c.corners = append(c.corners, raw)
+	}
+	c.faces = append(c.faces, face)
+}
 
-	// For each vertex of each triangle
-	for i := 0; i < len(vertexIndices); i++ {
+// objParser resolves chunks, in file order, into a Model.
+type objParser struct {
+	name string
+	opts *OBJOptions
 
-		// Get the indices of its attributes
-		vertexIndex := vertexIndices[i]
-		uvIndex := uvIndices[i]
-		normalIndex := normalIndices[i]
+	model              Model
+	vertices, normals  []mgl32.Vec3
+	uvs                []mgl32.Vec2
+	hasUvs, hasNormals bool
+	smoothing          uint32
+	hasSmoothing       bool
 
-		// Get the attributes thanks to the index
-		vertex := tempVertices[vertexIndex-1]
-		uv := tempUvs[uvIndex-1]
-		normal := tempNormals[normalIndex-1]
+	// Corners of the triangulated faces, turned into vertices by finish
+	// once their number is known.
+	triangles []objCorner
 
-		// Put the attributes in buffers
-		outVertices = append(outVertices, vertex)
-		outUvs = append(outUvs, uv)
-		outNormals = append(outNormals, normal)
+	corners []objCorner
+	polygon []mgl32.Vec3
+	tri     triangulator
+}
+
+func newOBJParser(name string, opts *OBJOptions) *objParser {
+	p := &objParser{name: name, opts: opts}
+	p.model.beginObject("", 0)
+	p.model.beginSubMesh("", 0)
+	return p
+}
+
+// apply resolves the faces of c against everything read so far and adds them
+// to the model, then returns the error c stopped at, if any.
+func (p *objParser) apply(c *objChunk) error {
+	vertexBase, uvBase, normalBase := len(p.vertices), len(p.uvs), len(p.normals)
+	p.vertices = append(p.vertices, c.vertices...)
+	p.uvs = append(p.uvs, c.uvs...)
+	p.normals = append(p.normals, c.normals...)
+
+	statements := c.statements
+	for f := 0; f <= len(c.faces); f++ {
+		for len(statements) > 0 && statements[0].face == f {
+			p.applyStatement(&statements[0])
+			statements = statements[1:]
+		}
+		if f == len(c.faces) {
+			break
+		}
+
+		face := &c.faces[f]
+		p.corners = p.corners[:0]
+		p.polygon = p.polygon[:0]
+		for _, raw := range c.corners[face.first : face.first+face.count] {
+			corner, ok := resolveCorner(raw, vertexBase+face.vertices, uvBase+face.uvs, normalBase+face.normals)
+			if !ok {
+				return &OBJError{File: p.name, Line: face.line, Token: formatCorner(raw), Err: ErrOBJIndex}
+			}
+			p.corners = append(p.corners, corner)
+			p.polygon = append(p.polygon, p.vertices[corner.vertex])
+		}
+		p.addFace(p.corners, p.polygon)
+	}
+	return c.err
+}
+
+func (p *objParser) applyStatement(s *objStatement) {
+	at := len(p.triangles)
+	switch s.keyword {
+	case "mtllib":
+		p.model.MaterialLibs = append(p.model.MaterialLibs, s.values...)
+	case "usemtl":
+		p.model.beginSubMesh(s.values[0], at)
+	case "o":
+		p.model.beginObject(s.values[0], at)
+	case "g":
+		p.model.beginGroup(s.values[0], at)
+	case "s":
+		p.smoothing = s.smoothing
+		p.hasSmoothing = p.hasSmoothing || s.smoothing != 0
+	}
+}
+
+// addFace triangulates a face whose corners have been resolved and appends it
+// to the model.
+func (p *objParser) addFace(corners []objCorner, polygon []mgl32.Vec3) {
+	mesh := &p.model.Mesh
+	mesh.Polygons++
+	if len(corners) > 3 {
+		mesh.Triangulated++
+	}
+
+	for _, i := range p.tri.triangulate(polygon) {
+		c := corners[i]
+		p.hasUvs = p.hasUvs || c.uv >= 0
+		p.hasNormals = p.hasNormals || c.normal >= 0
+		p.triangles = append(p.triangles, c)
+	}
+	for i := len(corners); i > 2; i-- {
+		mesh.Smoothing = append(mesh.Smoothing, p.smoothing)
+	}
+}
+
+// finish puts the attributes of every corner in buffers, closes the open
+// ranges and applies the post-processing options.
+func (p *objParser) finish() Model {
+	model := p.model
+	mesh := &model.Mesh
+	mesh.Vertices = make([]mgl32.Vec3, len(p.triangles))
+	if p.hasUvs {
+		mesh.Uvs = make([]mgl32.Vec2, len(p.triangles))
+	}
+	if p.hasNormals {
+		mesh.Normals = make([]mgl32.Vec3, len(p.triangles))
+	}
+	for i, c := range p.triangles {
+		mesh.Vertices[i] = p.vertices[c.vertex]
+		// Absent attributes stay zero
+		if c.uv >= 0 && p.hasUvs {
+			mesh.Uvs[i] = p.uvs[c.uv]
+		}
+		if c.normal >= 0 && p.hasNormals {
+			mesh.Normals[i] = p.normals[c.normal]
+		}
+	}
+
+	mesh.endSubMesh(len(p.triangles))
+	model.endObject(len(p.triangles))
+	if !p.hasSmoothing {
+		mesh.Smoothing = nil
+	}
+	if mesh.Normals == nil && p.opts.Normals != nil {
+		model.Mesh = GenerateNormals(model.Mesh, *p.opts.Normals)
+	}
+	if p.opts.Index {
+		model.Mesh = IndexMesh(model.Mesh)
+	}
+	return model
+}
+
+// parseCorner splits a face corner of the form v, v/vt, v//vn or v/vt/vn
+// into the indices written in the file, 0 for absent attributes.
+func parseCorner(corner []byte) (objCorner, error) {
+	var c objCorner
+	var parts [3][]byte
+	n := 0
+	start := 0
+	for i := 0; i <= len(corner); i++ {
+		if i < len(corner) && corner[i] != '/' {
+			continue
+		}
+		if n == len(parts) {
+			return c, ErrOBJFace
+		}
+		parts[n] = corner[start:i]
+		n++
+		start = i + 1
+	}
+
+	var ok bool
+	if c.vertex, ok = parseRawIndex(parts[0]); !ok {
+		return c, ErrOBJSyntax
+	}
+	if n > 1 && len(parts[1]) > 0 {
+		if c.uv, ok = parseRawIndex(parts[1]); !ok {
+			return c, ErrOBJSyntax
+		}
+	}
+	if n > 2 {
+		if c.normal, ok = parseRawIndex(parts[2]); !ok {
+			return c, ErrOBJSyntax
+		}
+	}
+	return c, nil
+}
+
+func parseRawIndex(b []byte) (int32, bool) {
+	i, ok := parseInt(b)
+	if !ok || i == 0 || i > math.MaxInt32 || i < -math.MaxInt32 {
+		return 0, false
+	}
+	return int32(i), true
+}
+
+// resolveCorner converts the indices of a corner as read into 0-based ones,
+// checking them against the number of elements read before the face.
+func resolveCorner(raw objCorner, numVertices, numUvs, numNormals int) (objCorner, bool) {
+	c := objCorner{uv: -1, normal: -1}
+	var ok bool
+	if c.vertex, ok = resolveIndex(raw.vertex, numVertices); !ok {
+		return c, false
+	}
+	if raw.uv != 0 {
+		if c.uv, ok = resolveIndex(raw.uv, numUvs); !ok {
+			return c, false
+		}
+	}
+	if raw.normal != 0 {
+		if c.normal, ok = resolveIndex(raw.normal, numNormals); !ok {
+			return c, false
+		}
+	}
+	return c, true
+}
+
+// resolveIndex converts an OBJ index into a 0-based one. Negative indices
+// count back from the last element, so -1 is the most recent one.
+func resolveIndex(i int32, count int) (int32, bool) {
+	index := int(i)
+	if index < 0 {
+		index += count + 1
+	}
+	if index < 1 || index > count {
+		return 0, false
+	}
+	return int32(index - 1), true
+}
+
+// formatCorner writes a corner back the way it was read, for error messages.
+func formatCorner(c objCorner) string {
+	s := strconv.Itoa(int(c.vertex))
+	switch {
+	case c.normal != 0 && c.uv != 0:
+		s += "/" + strconv.Itoa(int(c.uv)) + "/" + strconv.Itoa(int(c.normal))
+	case c.normal != 0:
+		s += "//" + strconv.Itoa(int(c.normal))
+	case c.uv != 0:
+		s += "/" + strconv.Itoa(int(c.uv))
+	}
+	return s
+}
+
+// LoadOBJFile opens and parses the OBJ file at path, along with the material
+// libraries it refers to. Libraries that don't exist are skipped.
+func LoadOBJFile(path string, opts *OBJOptions) (Mesh, error) {
+	model, err := LoadOBJModel(path, opts)
+	return model.Mesh, err
+}
+
+// LoadOBJModel is like LoadOBJFile but also returns the objects and groups
+// the triangles belong to.
+func LoadOBJModel(path string, opts *OBJOptions) (Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Model{}, err
+	}
+	defer f.Close()
+
+	model, err := ReadOBJModel(f, path, opts)
+	if err != nil {
+		return Model{}, err
+	}
+
+	// Material libraries are relative to the OBJ file
+	for _, lib := range model.MaterialLibs {
+		materials, err := LoadMTLFile(filepath.Join(filepath.Dir(path), lib))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Model{}, err
+		}
+		if model.Materials == nil {
+			model.Materials = make(map[string]*Material)
+		}
+		for name, material := range materials {
+			model.Materials[name] = material
+		}
+	}
+	return model, nil
+}
+
+// LoadOBJ appends the triangles of the OBJ file at path to the given slices.
+// V coordinates are negated for DDS textures and attributes missing from the
+// file are not appended. It reports false, leaving the slices unchanged, if
+// the file can't be loaded; use LoadOBJFile to find out why.
+func LoadOBJ(path string, outVertices []mgl32.Vec3, outUvs []mgl32.Vec2, outNormals []mgl32.Vec3) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, bool) {
+	mesh, err := LoadOBJFile(path, &OBJOptions{FlipV: VFlipNegate})
+	if err != nil {
+		return outVertices, outUvs, outNormals, false
 	}
 
+	outVertices = append(outVertices, mesh.Vertices...)
+	outUvs = append(outUvs, mesh.Uvs...)
+	outNormals = append(outNormals, mesh.Normals...)
 	return outVertices, outUvs, outNormals, true
 }
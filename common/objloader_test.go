@@ -0,0 +1,403 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const suzannePath = "../tutorial08/suzanne.obj"
+
+var (
+	largeOBJOnce sync.Once
+	largeOBJData []byte
+)
+
+// largeOBJ returns a generated grid of a little over a million triangles,
+// with positions, texture coordinates and normals, in the only face format
+// the Fscanf scanner reads.
+func largeOBJ() []byte {
+	largeOBJOnce.Do(func() {
+		const n = 708
+		var b []byte
+		for y := 0; y <= n; y++ {
+			for x := 0; x <= n; x++ {
+				b = append(b, "v "...)
+				b = strconv.AppendFloat(b, float64(x)/n, 'f', 6, 32)
+				b = append(b, ' ')
+				b = strconv.AppendFloat(b, float64(y)/n, 'f', 6, 32)
+				b = append(b, " 0.000000\nvt "...)
+				b = strconv.AppendFloat(b, float64(x)/n, 'f', 6, 32)
+				b = append(b, ' ')
+				b = strconv.AppendFloat(b, float64(y)/n, 'f', 6, 32)
+				b = append(b, '\n')
+			}
+		}
+		b = append(b, "vn 0.000000 0.000000 1.000000\n"...)
+		corner := func(b []byte, x, y int) []byte {
+			i := y*(n+1) + x + 1
+			b = append(b, ' ')
+			b = strconv.AppendInt(b, int64(i), 10)
+			b = append(b, '/')
+			b = strconv.AppendInt(b, int64(i), 10)
+			return append(b, "/1"...)
+		}
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				b = append(b, 'f')
+				b = corner(b, x, y)
+				b = corner(b, x+1, y)
+				b = corner(b, x+1, y+1)
+				b = append(b, "\nf"...)
+				b = corner(b, x, y)
+				b = corner(b, x+1, y+1)
+				b = corner(b, x, y+1)
+				b = append(b, '\n')
+			}
+		}
+		largeOBJData = b
+	})
+	return largeOBJData
+}
+
+// benchmarkOBJs returns the inputs of the OBJ benchmarks by name.
+func benchmarkOBJs(b *testing.B) []struct {
+	name string
+	data []byte
+} {
+	suzanne, err := os.ReadFile(suzannePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return []struct {
+		name string
+		data []byte
+	}{
+		{"suzanne", suzanne},
+		{"1M faces", largeOBJ()},
+	}
+}
+
+func BenchmarkReadOBJ(b *testing.B) {
+	for _, input := range benchmarkOBJs(b) {
+		b.Run(input.name, func(b *testing.B) {
+			b.SetBytes(int64(len(input.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ReadOBJ(bytes.NewReader(input.data), input.name, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkReadOBJFscanf measures the scanner ReadOBJ replaced, for
+// comparison with BenchmarkReadOBJ.
+func BenchmarkReadOBJFscanf(b *testing.B) {
+	for _, input := range benchmarkOBJs(b) {
+		b.Run(input.name, func(b *testing.B) {
+			b.SetBytes(int64(len(input.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, _, ok := loadOBJFscanf(bytes.NewReader(input.data)); !ok {
+					b.Fatal("can't read", input.name)
+				}
+			}
+		})
+	}
+}
+
+// loadOBJFscanf is the original LoadOBJ, which reads one token at a time with
+// fmt.Fscanf. It is only kept as a baseline for benchmarks.
+func loadOBJFscanf(f io.Reader) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, bool) {
+	var vertexIndices, uvIndices, normalIndices []uint32
+	var tempVertices, tempNormals []mgl32.Vec3
+	var tempUvs []mgl32.Vec2
+	var outVertices, outNormals []mgl32.Vec3
+	var outUvs []mgl32.Vec2
+
+	for {
+		var lineHeader string
+		// read the first word of the line
+		_, err := fmt.Fscanf(f, "%s", &lineHeader)
+		if err == io.EOF {
+			break // EOF = End Of File. Quit the loop.
+		}
+
+		// else : parse lineHeader
+
+		if strings.Compare(string(lineHeader), "v") == 0 {
+			var vertex mgl32.Vec3
+			fmt.Fscanf(f, "%f %f %f\n", &vertex[0], &vertex[1], &vertex[2])
+			tempVertices = append(tempVertices, vertex)
+		} else if strings.Compare(string(lineHeader), "vt") == 0 {
+			var uv mgl32.Vec2
+			fmt.Fscanf(f, "%f %f\n", &uv[0], &uv[1])
+			uv[1] = -uv[1]
+			tempUvs = append(tempUvs, uv)
+		} else if strings.Compare(string(lineHeader), "vn") == 0 {
+			var normal mgl32.Vec3
+			fmt.Fscanf(f, "%f %f %f\n", &normal[0], &normal[1], &normal[2])
+			tempNormals = append(tempNormals, normal)
+		} else if strings.Compare(string(lineHeader), "f") == 0 {
+			var vertexIndex, uvIndex, normalIndex [3]uint32
+			matches, _ := fmt.Fscanf(f, "%d/%d/%d %d/%d/%d %d/%d/%d\n", &vertexIndex[0], &uvIndex[0], &normalIndex[0], &vertexIndex[1], &uvIndex[1], &normalIndex[1], &vertexIndex[2], &uvIndex[2], &normalIndex[2])
+			if matches != 9 {
+				return nil, nil, nil, false
+			}
+			vertexIndices = append(vertexIndices, vertexIndex[:]...)
+			uvIndices = append(uvIndices, uvIndex[:]...)
+			normalIndices = append(normalIndices, normalIndex[:]...)
+		}
+	}
+
+	// For each vertex of each triangle
+	for i := range vertexIndices {
+		outVertices = append(outVertices, tempVertices[vertexIndices[i]-1])
+		outUvs = append(outUvs, tempUvs[uvIndices[i]-1])
+		outNormals = append(outNormals, tempNormals[normalIndices[i]-1])
+	}
+
+	return outVertices, outUvs, outNormals, true
+}
+
+// readOBJBothWays reads data sequentially and with each number of workers
+// from 2 to maxWorkers, and fails unless every result is the same.
+func readOBJBothWays(t *testing.T, name string, data []byte, maxWorkers int) Model {
+	t.Helper()
+	want, err := ReadOBJModel(bytes.NewReader(data), name, &OBJOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("sequential: %v", err)
+	}
+	for workers := 2; workers <= maxWorkers; workers++ {
+		got, err := ReadOBJModel(bytes.NewReader(data), name, &OBJOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %d workers read a different model than the sequential parser", name, workers)
+		}
+	}
+	return want
+}
+
+func TestReadOBJParallelModels(t *testing.T) {
+	for _, path := range []string{"../tutorial04/box.obj", "../tutorial07/cube.obj", suzannePath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		model := readOBJBothWays(t, path, data, 8)
+		if model.TriangleCount() == 0 {
+			t.Errorf("%s: no triangles", path)
+		}
+	}
+}
+
+// straddlingOBJ has negative indices, CRLF line endings, and object, group,
+// material and smoothing statements between faces throughout the file, so
+// that splitting it anywhere cuts between some of them.
+func straddlingOBJ() []byte {
+	var b strings.Builder
+	b.WriteString("mtllib a.mtl\r\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&b, "v %d 0 0\r\nv %d 1 0\r\nv %d 0 1\r\nv %d 1 1\r\n", i, i, i, i)
+		fmt.Fprintf(&b, "vt 0.%d 0.5\r\nvn 0 0 1\r\n", i%10)
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&b, "o object%d\r\n", i)
+		case 1:
+			fmt.Fprintf(&b, "g group%d\r\n", i)
+		case 2:
+			fmt.Fprintf(&b, "usemtl material%d\r\n", i%3)
+		case 3:
+			fmt.Fprintf(&b, "s %d\r\n", i%2)
+		}
+		b.WriteString("f -4/-1/-1 -3/-1/-1 -1/-1/-1 -2/-1/-1\r\n")
+		fmt.Fprintf(&b, "f %d//%d -3//-1 -2//-1\r\n", 4*i+1, i+1)
+	}
+	return []byte(b.String())
+}
+
+func TestReadOBJParallelStraddling(t *testing.T) {
+	model := readOBJBothWays(t, "straddling.obj", straddlingOBJ(), 16)
+	if got, want := model.TriangleCount(), 40*3; got != want {
+		t.Errorf("%d triangles, want %d", got, want)
+	}
+	if got, want := len(model.Objects), 10; got != want {
+		t.Errorf("%d objects, want %d", got, want)
+	}
+}
+
+func TestReadOBJParallelError(t *testing.T) {
+	body := straddlingOBJ()
+	// The first error must be reported, whichever worker finds it
+	for _, tc := range []struct {
+		name string
+		data []byte
+		line int
+		err  error
+	}{
+		{"index", append(body[:len(body):len(body)], "f 1 2 99999\r\nv 1 x 0\r\n"...), bytes.Count(body, []byte{'\n'}) + 1, ErrOBJIndex},
+		{"syntax", append([]byte("v 1 x 0\r\n"), body...), 1, ErrOBJSyntax},
+	} {
+		_, seqErr := ReadOBJ(bytes.NewReader(tc.data), "bad.obj", &OBJOptions{Workers: 1})
+		var want *OBJError
+		if !errors.As(seqErr, &want) || !errors.Is(seqErr, tc.err) || want.Line != tc.line {
+			t.Fatalf("%s: sequential: got %v, want %v on line %d", tc.name, seqErr, tc.err, tc.line)
+		}
+		for workers := 2; workers <= 16; workers++ {
+			_, err := ReadOBJ(bytes.NewReader(tc.data), "bad.obj", &OBJOptions{Workers: workers})
+			var got *OBJError
+			if !errors.As(err, &got) || *got != *want {
+				t.Errorf("%s: %d workers: got %v, want %v", tc.name, workers, err, seqErr)
+			}
+		}
+	}
+}
+
+// objTriangle has a vertex, a texture coordinate and a normal for each of
+// its corners, before the face given to it.
+const objTriangle = `v 0 0 0
+v 1 0 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 0 1
+vn 0 0 1
+`
+
+func TestReadOBJFaceForms(t *testing.T) {
+	vertices := []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}
+	uvs := []mgl32.Vec2{{0, 0}, {1, 0}, {0, 1}}
+	normals := []mgl32.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}}
+	for _, tc := range []struct {
+		face    string
+		uvs     []mgl32.Vec2
+		normals []mgl32.Vec3
+	}{
+		{"f 1 2 3", nil, nil},
+		{"f 1/1 2/2 3/3", uvs, nil},
+		{"f 1//1 2//1 3//1", nil, normals},
+		{"f 1/1/1 2/2/1 3/3/1", uvs, normals},
+		{"f -3/-3/-1 -2/-2/-1 -1/-1/-1", uvs, normals},
+		// Corners without an attribute others have get zeros
+		{"f 1 2/2 3//1", []mgl32.Vec2{{0, 0}, {1, 0}, {0, 0}}, []mgl32.Vec3{{0, 0, 0}, {0, 0, 0}, {0, 0, 1}}},
+	} {
+		m, err := ReadOBJ(strings.NewReader(objTriangle+tc.face), "forms.obj", nil)
+		if err != nil {
+			t.Errorf("%q: %v", tc.face, err)
+			continue
+		}
+		if !reflect.DeepEqual(m.Vertices, vertices) || !reflect.DeepEqual(m.Uvs, tc.uvs) || !reflect.DeepEqual(m.Normals, tc.normals) {
+			t.Errorf("%q: got vertices %v, uvs %v and normals %v", tc.face, m.Vertices, m.Uvs, m.Normals)
+		}
+	}
+}
+
+func TestReadOBJErrors(t *testing.T) {
+	for _, tc := range []struct {
+		data  string
+		line  int
+		token string
+		err   error
+	}{
+		{"v 1 2 x", 1, "x", ErrOBJSyntax},
+		{"v 1 2 3\nvt", 2, "vt", ErrOBJSyntax},
+		{"usemtl", 1, "usemtl", ErrOBJSyntax},
+		{"s smooth", 1, "smooth", ErrOBJSyntax},
+		{objTriangle + "f 1 2", 8, "f 1 2", ErrOBJFace},
+		{objTriangle + "f 1/1/1/1 2 3", 8, "1/1/1/1", ErrOBJFace},
+		{objTriangle + "# comment\nf 1 2 a", 9, "a", ErrOBJSyntax},
+		{objTriangle + "f 1 2 4", 8, "4", ErrOBJIndex},
+		{objTriangle + "f -4 -3 -2", 8, "-4", ErrOBJIndex},
+		{objTriangle + "f 1/1 2/4 3/3", 8, "2/4", ErrOBJIndex},
+		{objTriangle + "f 1//1 2//1 3//2", 8, "3//2", ErrOBJIndex},
+		{objTriangle + "f 0 1 2", 8, "0", ErrOBJSyntax},
+	} {
+		_, err := ReadOBJ(strings.NewReader(tc.data), "bad.obj", nil)
+		want := &OBJError{File: "bad.obj", Line: tc.line, Token: tc.token, Err: tc.err}
+		var got *OBJError
+		if !errors.As(err, &got) || !errors.Is(err, tc.err) || *got != *want {
+			t.Errorf("%q: got %#v, want %#v", tc.data, err, want)
+		}
+	}
+
+	err := error(&OBJError{File: "bad.obj", Line: 8, Token: "f 1 2", Err: ErrOBJFace})
+	if want := `bad.obj:8: "f 1 2": unsupported face format`; err.Error() != want {
+		t.Errorf("got message %q, want %q", err.Error(), want)
+	}
+}
+
+func TestReadOBJPolygons(t *testing.T) {
+	// A triangle, a quad, a dart whose fifth vertex makes it concave, and a
+	// hexagon, all facing +Z
+	const data = `v 0 0 0
+v 4 0 0
+v 4 4 0
+v 2 1 0
+v 0 4 0
+v 6 0 0
+v 8 0 0
+v 9 2 0
+v 8 4 0
+v 6 4 0
+v 5 2 0
+f 1 2 3
+f 1 2 3 5
+f 1 2 3 4 5
+f 6 7 8 9 10 11
+`
+	m, err := ReadOBJ(strings.NewReader(data), "polygons.obj", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Polygons != 4 || m.Triangulated != 3 || m.TriangleCount() != 1+2+3+4 {
+		t.Errorf("%d polygons, %d triangulated, %d triangles, want 4, 3 and 10", m.Polygons, m.Triangulated, m.TriangleCount())
+	}
+	// No triangle turns over, and together they cover each polygon once
+	var area float32
+	for i := 0; i < m.TriangleCount(); i++ {
+		a, b, c := m.Triangle(i)
+		p0, p1, p2 := m.Vertices[a], m.Vertices[b], m.Vertices[c]
+		normal := p1.Sub(p0).Cross(p2.Sub(p0))
+		if normal.Z() <= 0 {
+			t.Errorf("triangle %v %v %v faces %v", p0, p1, p2, normal)
+		}
+		area += normal.Len() / 2
+	}
+	if want := float32(8 + 16 + 10 + 12); area != want {
+		t.Errorf("area %v, want %v", area, want)
+	}
+}
+
+func TestReadOBJNames(t *testing.T) {
+	// Names keep their inner spaces, repeated or not, and lose the ones
+	// around them
+	data := objTriangle + "o  my  object \r\ng left\tarm\nusemtl red  paint \nf 1 2 3\n"
+	m, err := ReadOBJModel(strings.NewReader(data), "names.obj", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Objects) != 1 || len(m.Objects[0].Groups) != 1 || len(m.SubMeshes) != 1 {
+		t.Fatalf("got objects %+v and sub-meshes %+v", m.Objects, m.SubMeshes)
+	}
+	for _, tc := range []struct{ got, want string }{
+		{m.Objects[0].Name, "my  object"},
+		{m.Objects[0].Groups[0].Name, "left\tarm"},
+		{m.SubMeshes[0].Material, "red  paint"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package common
+
+import (
+	"bufio"
+	"github.com/go-gl/mathgl/mgl32"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// OBJIndexStyle selects how WriteOBJ refers to vertices from faces.
+type OBJIndexStyle int
+
+const (
+	// OBJAbsoluteIndices counts from the first element of the file, from 1.
+	OBJAbsoluteIndices OBJIndexStyle = iota
+	// OBJRelativeIndices counts back from the last element written, from -1.
+	OBJRelativeIndices
+)
+
+// OBJWriteOptions controls WriteOBJ. A nil *OBJWriteOptions is the same as
+// the zero value.
+type OBJWriteOptions struct {
+	// Precision is the number of digits after the decimal point. 0 writes
+	// the shortest representation that reads back to the same float32.
+	Precision int
+	Indices   OBJIndexStyle
+	// Groups writes the objects, groups, materials and smoothing groups of
+	// the model. Otherwise only the geometry is written.
+	Groups bool
+	// FlipV converts V coordinates back, when the model was loaded with it.
+	FlipV VFlip
+}
+
+// WriteOBJ writes m to w as an OBJ file. Identical positions, uvs and normals
+// are written once, and faces are written as the triangles of m.
+func WriteOBJ(w io.Writer, m Model, opts *OBJWriteOptions) error {
+	if opts == nil {
+		opts = &OBJWriteOptions{}
+	}
+	ow := objWriter{w: bufio.NewWriter(w), precision: -1}
+	if opts.Precision > 0 {
+		ow.precision = opts.Precision
+	}
+
+	if opts.Groups {
+		for _, lib := range m.MaterialLibs {
+			ow.line("mtllib", lib)
+		}
+	}
+
+	// Write every distinct attribute once, remembering its 1-based index
+	vertexIndices := make([]int, len(m.Vertices))
+	seenVertices := make(map[mgl32.Vec3]int)
+	numVertices := 0
+	for i, vertex := range m.Vertices {
+		if index, found := seenVertices[vertex]; found {
+			vertexIndices[i] = index
+			continue
+		}
+		numVertices++
+		seenVertices[vertex] = numVertices
+		vertexIndices[i] = numVertices
+		ow.floats("v", vertex[:])
+	}
+	var uvIndices []int
+	numUvs := 0
+	if m.Uvs != nil {
+		uvIndices = make([]int, len(m.Uvs))
+		seenUvs := make(map[mgl32.Vec2]int)
+		for i, uv := range m.Uvs {
+			uv = opts.FlipV.Apply(uv)
+			if index, found := seenUvs[uv]; found {
+				uvIndices[i] = index
+				continue
+			}
+			numUvs++
+			seenUvs[uv] = numUvs
+			uvIndices[i] = numUvs
+			ow.floats("vt", uv[:])
+		}
+	}
+	var normalIndices []int
+	numNormals := 0
+	if m.Normals != nil {
+		normalIndices = make([]int, len(m.Normals))
+		seenNormals := make(map[mgl32.Vec3]int)
+		for i, normal := range m.Normals {
+			if index, found := seenNormals[normal]; found {
+				normalIndices[i] = index
+				continue
+			}
+			numNormals++
+			seenNormals[normal] = numNormals
+			normalIndices[i] = numNormals
+			ow.floats("vn", normal[:])
+		}
+	}
+
+	index := func(i, count int) int {
+		if opts.Indices == OBJRelativeIndices {
+			return i - count - 1
+		}
+		return i
+	}
+
+	var ranges objRanges
+	for t := 0; t < m.TriangleCount(); t++ {
+		if opts.Groups {
+			ranges.writeStatements(&ow, &m, t)
+		}
+
+		a, b, c := m.Triangle(t)
+		ow.buf = append(ow.buf[:0], 'f')
+		for _, i := range [3]uint32{a, b, c} {
+			ow.buf = append(ow.buf, ' ')
+			ow.buf = strconv.AppendInt(ow.buf, int64(index(vertexIndices[i], numVertices)), 10)
+			if uvIndices != nil || normalIndices != nil {
+				ow.buf = append(ow.buf, '/')
+			}
+			if uvIndices != nil {
+				ow.buf = strconv.AppendInt(ow.buf, int64(index(uvIndices[i], numUvs)), 10)
+			}
+			if normalIndices != nil {
+				ow.buf = append(ow.buf, '/')
+				ow.buf = strconv.AppendInt(ow.buf, int64(index(normalIndices[i], numNormals)), 10)
+			}
+		}
+		ow.write()
+	}
+
+	if ow.err != nil {
+		return ow.err
+	}
+	return ow.w.Flush()
+}
+
+// objRanges follows which object, group, material and smoothing group the
+// triangles being written belong to.
+type objRanges struct {
+	started                bool
+	object, group, subMesh int
+	material               string
+	smoothing              uint32
+}
+
+// writeStatements writes the statements needed before triangle t.
+func (r *objRanges) writeStatements(ow *objWriter, m *Model, t int) {
+	at := 3 * t
+	if len(m.Objects) > 0 {
+		for r.object < len(m.Objects)-1 && at >= m.Objects[r.object].First+m.Objects[r.object].Count {
+			r.object++
+			r.group = 0
+		}
+		object := &m.Objects[r.object]
+		if at == object.First && object.Name != "" {
+			ow.line("o", object.Name)
+		}
+		for r.group < len(object.Groups)-1 && at >= object.Groups[r.group].First+object.Groups[r.group].Count {
+			r.group++
+		}
+		if len(object.Groups) > 0 {
+			group := &object.Groups[r.group]
+			if at == group.First && (group.Name != "" || at != object.First) {
+				ow.line("g", group.Name)
+			}
+		}
+	}
+
+	for r.subMesh < len(m.SubMeshes)-1 && at >= m.SubMeshes[r.subMesh].First+m.SubMeshes[r.subMesh].Count {
+		r.subMesh++
+	}
+	if len(m.SubMeshes) > 0 {
+		material := m.SubMeshes[r.subMesh].Material
+		// Unnamed materials can't be written, the previous one carries on
+		if material != r.material && material != "" {
+			ow.line("usemtl", material)
+			r.material = material
+		}
+	}
+
+	if m.Smoothing != nil && (m.Smoothing[t] != r.smoothing || !r.started) {
+		r.smoothing = m.Smoothing[t]
+		if r.smoothing == 0 {
+			ow.line("s", "off")
+		} else {
+			ow.line("s", strconv.FormatUint(uint64(r.smoothing), 10))
+		}
+	}
+	r.started = true
+}
+
+// objWriter formats lines in a reused buffer, keeping the first error.
+type objWriter struct {
+	w         *bufio.Writer
+	buf       []byte
+	precision int
+	err       error
+}
+
+func (ow *objWriter) write() {
+	ow.buf = append(ow.buf, '\n')
+	if ow.err == nil {
+		_, ow.err = ow.w.Write(ow.buf)
+	}
+}
+
+func (ow *objWriter) line(keyword, value string) {
+	ow.buf = append(ow.buf[:0], keyword...)
+	if value != "" {
+		ow.buf = append(ow.buf, ' ')
+		ow.buf = append(ow.buf, value...)
+	}
+	ow.write()
+}
+
+func (ow *objWriter) floats(keyword string, values []float32) {
+	ow.buf = append(ow.buf[:0], keyword...)
+	for _, f := range values {
+		ow.buf = append(ow.buf, ' ')
+		ow.buf = ow.appendFloat(ow.buf, f)
+	}
+	ow.write()
+}
+
+func (ow *objWriter) appendFloat(buf []byte, f float32) []byte {
+	if ow.precision < 0 {
+		return strconv.AppendFloat(buf, float64(f), 'g', -1, 32)
+	}
+	return strconv.AppendFloat(buf, float64(f), 'f', ow.precision, 32)
+}
+
+// WriteMTL writes materials to w as an MTL material library, sorted by name.
+func WriteMTL(w io.Writer, materials map[string]*Material, opts *OBJWriteOptions) error {
+	if opts == nil {
+		opts = &OBJWriteOptions{}
+	}
+	ow := objWriter{w: bufio.NewWriter(w), precision: -1}
+	if opts.Precision > 0 {
+		ow.precision = opts.Precision
+	}
+
+	names := make([]string, 0, len(materials))
+	for name := range materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		material := materials[name]
+		if i > 0 {
+			ow.line("", "")
+		}
+		ow.line("newmtl", name)
+		ow.floats("Ka", material.Ambient[:])
+		ow.floats("Kd", material.Diffuse[:])
+		ow.floats("Ks", material.Specular[:])
+		ow.floats("Ns", []float32{material.Shininess})
+		ow.floats("d", []float32{material.Dissolve})
+		ow.line("illum", strconv.Itoa(material.Illum))
+		if material.DiffuseMap != "" {
+			ow.line("map_Kd", material.DiffuseMap)
+		}
+		if material.BumpMap != "" {
+			ow.line("map_Bump", material.BumpMap)
+		}
+		if material.SpecularMap != "" {
+			ow.line("map_Ks", material.SpecularMap)
+		}
+	}
+
+	if ow.err != nil {
+		return ow.err
+	}
+	return ow.w.Flush()
+}
+
+// SaveOBJFile writes m to the OBJ file at path.
+func SaveOBJFile(path string, m Model, opts *OBJWriteOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteOBJ(f, m, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// groupsOBJ has objects, groups, materials, smoothing groups and a quad.
+const groupsOBJ = `mtllib a.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0.25
+vt 1 0.25
+vt 1 0.75
+vt 0 0.75
+f 1/1 2/2 3/3
+usemtl red
+f 1/1 2/2 3/3 4/4
+o A
+g x y
+s 3
+usemtl blue
+f 1/1 2/2 3/3
+g
+f 1/4 2/3 3/2
+s off
+f 1/1 2/2 3/3
+`
+
+// roundTripOBJ writes m with opts, then reads it back like m was read.
+func roundTripOBJ(t *testing.T, m Model, opts *OBJWriteOptions, readOpts *OBJOptions) Model {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteOBJ(&buf, m, opts); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadOBJModel(&buf, "written.obj", readOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestWriteOBJRoundTrip(t *testing.T) {
+	for _, style := range []OBJIndexStyle{OBJAbsoluteIndices, OBJRelativeIndices} {
+		for _, index := range []bool{false, true} {
+			readOpts := &OBJOptions{Index: index, FlipV: VFlipNegate}
+			want, err := LoadOBJModel(suzannePath, readOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := roundTripOBJ(t, want, &OBJWriteOptions{Indices: style, Groups: true, FlipV: VFlipNegate}, readOpts)
+			// Quads are written as the two triangles they were split into
+			got.Polygons, got.Triangulated = want.Polygons, want.Triangulated
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("suzanne, index style %d, indexed %v: model changed", style, index)
+			}
+		}
+	}
+}
+
+func TestWriteOBJGroups(t *testing.T) {
+	for _, style := range []OBJIndexStyle{OBJAbsoluteIndices, OBJRelativeIndices} {
+		readOpts := &OBJOptions{FlipV: VFlipOneMinus}
+		want, err := ReadOBJModel(strings.NewReader(groupsOBJ), "groups.obj", readOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := roundTripOBJ(t, want, &OBJWriteOptions{Indices: style, Groups: true, FlipV: VFlipOneMinus}, readOpts)
+		got.Polygons, got.Triangulated = want.Polygons, want.Triangulated
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("index style %d: got %+v, want %+v", style, got, want)
+		}
+
+		// Without groups only the geometry is kept
+		got = roundTripOBJ(t, want, &OBJWriteOptions{Indices: style, FlipV: VFlipOneMinus}, readOpts)
+		if !reflect.DeepEqual(got.Vertices, want.Vertices) || !reflect.DeepEqual(got.Uvs, want.Uvs) {
+			t.Errorf("index style %d without groups: geometry changed", style)
+		}
+		if len(got.Objects) != 1 || len(got.SubMeshes) != 1 || got.MaterialLibs != nil {
+			t.Errorf("index style %d without groups: got %d objects and %d sub-meshes", style, len(got.Objects), len(got.SubMeshes))
+		}
+	}
+}
+
+func TestWriteMTLRoundTrip(t *testing.T) {
+	const mtl = `newmtl red
+Ka 0.1 0.1 0.1
+Kd 1 0 0
+Ks 0.5 0.5 0.5
+Ns 96.078431
+d 0.75
+illum 2
+map_Kd -s 1 1 1 red texture.png
+map_Bump bump.png
+
+newmtl blue
+Kd 0 0 1
+Tr 0.25
+map_Ks specular.tga
+`
+	want, err := ReadMTL(strings.NewReader(mtl), "a.mtl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteMTL(&buf, want, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadMTL(&buf, "written.mtl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
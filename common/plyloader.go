@@ -0,0 +1,596 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Errors wrapped by PLYError.
+var (
+	ErrPLYHeader = errors.New("malformed header")
+	ErrPLYData   = errors.New("malformed element")
+	ErrPLYIndex  = errors.New("index out of range")
+)
+
+// PLYOptions controls how ReadPLY builds its Mesh. A nil *PLYOptions is the
+// same as the zero value.
+type PLYOptions struct {
+	// Index keeps the mesh indexed, see IndexMesh.
+	Index bool
+	// Normals, if not nil, computes normals for files that have none.
+	Normals *NormalOptions
+	// FlipV converts V texture coordinates for the texture loader in use.
+	FlipV VFlip
+}
+
+// PLYError reports where in a PLY file parsing failed. Element is empty for
+// errors in the header, where Index is the line number.
+type PLYError struct {
+	File    string
+	Element string
+	Index   int
+	Err     error
+}
+
+func (e *PLYError) Error() string {
+	if e.Element == "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Index, e.Err)
+	}
+	return fmt.Sprintf("%s: %s %d: %v", e.File, e.Element, e.Index, e.Err)
+}
+
+func (e *PLYError) Unwrap() error {
+	return e.Err
+}
+
+// plyType is the type of a property value.
+type plyType int
+
+const (
+	plyInt8 plyType = iota
+	plyUint8
+	plyInt16
+	plyUint16
+	plyInt32
+	plyUint32
+	plyFloat32
+	plyFloat64
+)
+
+var plyTypes = map[string]plyType{
+	"char": plyInt8, "int8": plyInt8,
+	"uchar": plyUint8, "uint8": plyUint8,
+	"short": plyInt16, "int16": plyInt16,
+	"ushort": plyUint16, "uint16": plyUint16,
+	"int": plyInt32, "int32": plyInt32,
+	"uint": plyUint32, "uint32": plyUint32,
+	"float": plyFloat32, "float32": plyFloat32,
+	"double": plyFloat64, "float64": plyFloat64,
+}
+
+func (t plyType) size() int {
+	switch t {
+	case plyInt8, plyUint8:
+		return 1
+	case plyInt16, plyUint16:
+		return 2
+	case plyFloat64:
+		return 8
+	}
+	return 4
+}
+
+func (t plyType) isFloat() bool {
+	return t == plyFloat32 || t == plyFloat64
+}
+
+// maxColor is what a color stored as t is divided by to be in [0, 1].
+func (t plyType) maxColor() float32 {
+	switch t {
+	case plyInt8:
+		return math.MaxInt8
+	case plyUint8:
+		return math.MaxUint8
+	case plyInt16:
+		return math.MaxInt16
+	case plyUint16:
+		return math.MaxUint16
+	case plyInt32:
+		return math.MaxInt32
+	case plyUint32:
+		return math.MaxUint32
+	}
+	return 1
+}
+
+type plyProperty struct {
+	name      string
+	typ       plyType
+	list      bool
+	countType plyType
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// Attributes a vertex property can hold, as indices in the values of a vertex
+const (
+	plyX = iota
+	plyY
+	plyZ
+	plyNX
+	plyNY
+	plyNZ
+	plyRed
+	plyGreen
+	plyBlue
+	plyAlpha
+	plyU
+	plyV
+	plySlots
+)
+
+// plyVertexProperties maps the vertex property names used by common
+// exporters to attributes. Unknown properties are skipped.
+var plyVertexProperties = map[string]int{
+	"x": plyX, "y": plyY, "z": plyZ,
+	"nx": plyNX, "ny": plyNY, "nz": plyNZ,
+	"red": plyRed, "green": plyGreen, "blue": plyBlue, "alpha": plyAlpha,
+	"diffuse_red": plyRed, "diffuse_green": plyGreen, "diffuse_blue": plyBlue, "diffuse_alpha": plyAlpha,
+	"u": plyU, "v": plyV, "s": plyU, "t": plyV,
+	"texture_u": plyU, "texture_v": plyV, "texture_s": plyU, "texture_t": plyV,
+}
+
+// ReadPLY parses a Stanford PLY file from r, in ASCII or binary of either
+// byte order. name is only used in error messages.
+//
+// The "vertex" element gives positions, and normals, colors and texture
+// coordinates when it has the properties for them. The "face" element's
+// vertex_indices lists are triangulated like OBJ faces. Other elements and
+// properties are skipped. A point cloud, with no faces, is returned indexed
+// with no indices, so its vertices can still be drawn as points.
+func ReadPLY(r io.Reader, name string, opts *PLYOptions) (Mesh, error) {
+	if opts == nil {
+		opts = &PLYOptions{}
+	}
+	br := bufio.NewReader(r)
+	p := &plyReader{name: name, opts: opts, r: br}
+	if err := p.readHeader(); err != nil {
+		return Mesh{}, err
+	}
+
+	if p.format == "ascii" {
+		p.scanner = bufio.NewScanner(br)
+		p.scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	}
+	for i := range p.elements {
+		if err := p.readElement(&p.elements[i]); err != nil {
+			return Mesh{}, err
+		}
+	}
+	return p.finish()
+}
+
+// plyReader reads the elements of a PLY file. Faces are only triangulated
+// in finish, since the vertices might come after them.
+type plyReader struct {
+	name     string
+	opts     *PLYOptions
+	r        *bufio.Reader
+	format   string
+	order    binary.ByteOrder
+	elements []plyElement
+
+	// ASCII values of the current element
+	scanner *bufio.Scanner
+	fields  [][]byte
+	// Binary values are read through buf
+	buf [8]byte
+
+	// Position in the body, for errors
+	elementName  string
+	elementIndex int
+
+	mesh                          Mesh
+	hasNormals, hasColors, hasUvs bool
+	hasFaces                      bool
+	faces                         []uint32 // corners of every face, in order
+	faceSizes                     []int
+	triangulator                  triangulator
+	polygon                       []mgl32.Vec3
+}
+
+func (p *plyReader) fail(err error) error {
+	return &PLYError{File: p.name, Element: p.elementName, Index: p.elementIndex, Err: err}
+}
+
+func (p *plyReader) readHeader() error {
+	line := 0
+	failf := func(format string, args ...any) error {
+		return &PLYError{File: p.name, Index: line, Err: fmt.Errorf("%w: "+format, append([]any{ErrPLYHeader}, args...)...)}
+	}
+
+	for {
+		text, err := p.r.ReadString('\n')
+		if err != nil && (err != io.EOF || text == "") {
+			if err == io.EOF {
+				return failf("no end_header")
+			}
+			return err
+		}
+		line++
+		fields := strings.Fields(text)
+		if line == 1 {
+			if len(fields) != 1 || fields[0] != "ply" {
+				return failf("not a PLY file")
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) < 3 || !strings.HasPrefix(fields[2], "1.") {
+				return failf("unsupported format %q", strings.Join(fields[1:], " "))
+			}
+			p.format = fields[1]
+			switch p.format {
+			case "ascii":
+			case "binary_little_endian":
+				p.order = binary.LittleEndian
+			case "binary_big_endian":
+				p.order = binary.BigEndian
+			default:
+				return failf("unsupported format %q", p.format)
+			}
+		case "comment", "obj_info":
+		case "element":
+			if len(fields) != 3 {
+				return failf("%q", strings.TrimSpace(text))
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return failf("element count %q", fields[2])
+			}
+			p.elements = append(p.elements, plyElement{name: fields[1], count: count})
+		case "property":
+			if len(p.elements) == 0 {
+				return failf("property outside of an element")
+			}
+			var property plyProperty
+			var ok bool
+			switch {
+			case len(fields) == 3:
+				property.name = fields[2]
+				property.typ, ok = plyTypes[fields[1]]
+			case len(fields) == 5 && fields[1] == "list":
+				property.name = fields[4]
+				property.list = true
+				var countOK bool
+				property.countType, countOK = plyTypes[fields[2]]
+				property.typ, ok = plyTypes[fields[3]]
+				ok = ok && countOK && !property.countType.isFloat()
+			}
+			if !ok {
+				return failf("property %q", strings.TrimSpace(text))
+			}
+			element := &p.elements[len(p.elements)-1]
+			element.properties = append(element.properties, property)
+		case "end_header":
+			if p.format == "" {
+				return failf("no format")
+			}
+			return nil
+		default:
+			return failf("unknown keyword %q", fields[0])
+		}
+	}
+}
+
+// nextElement moves to the next element of an ASCII file.
+func (p *plyReader) nextElement() error {
+	if p.scanner == nil {
+		return nil
+	}
+	for p.scanner.Scan() {
+		p.fields = splitFields(p.fields, p.scanner.Bytes())
+		if len(p.fields) > 0 {
+			return nil
+		}
+	}
+	if err := p.scanner.Err(); err != nil {
+		return p.fail(err)
+	}
+	return p.fail(fmt.Errorf("%w: unexpected end of file", ErrPLYData))
+}
+
+// value reads the next value of the current element.
+func (p *plyReader) value(t plyType) (float64, error) {
+	if p.scanner != nil {
+		if len(p.fields) == 0 {
+			return 0, p.fail(fmt.Errorf("%w: missing values", ErrPLYData))
+		}
+		field := p.fields[0]
+		p.fields = p.fields[1:]
+		if t.isFloat() {
+			f, ok := parseFloat(field)
+			if !ok {
+				return 0, p.fail(fmt.Errorf("%w: %q", ErrPLYData, field))
+			}
+			return float64(f), nil
+		}
+		n, ok := parseInt(field)
+		if !ok {
+			return 0, p.fail(fmt.Errorf("%w: %q", ErrPLYData, field))
+		}
+		return float64(n), nil
+	}
+
+	b := p.buf[:t.size()]
+	if _, err := io.ReadFull(p.r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: unexpected end of file", ErrPLYData)
+		}
+		return 0, p.fail(err)
+	}
+	switch t {
+	case plyInt8:
+		return float64(int8(b[0])), nil
+	case plyUint8:
+		return float64(b[0]), nil
+	case plyInt16:
+		return float64(int16(p.order.Uint16(b))), nil
+	case plyUint16:
+		return float64(p.order.Uint16(b)), nil
+	case plyInt32:
+		return float64(int32(p.order.Uint32(b))), nil
+	case plyUint32:
+		return float64(p.order.Uint32(b)), nil
+	case plyFloat32:
+		return float64(math.Float32frombits(p.order.Uint32(b))), nil
+	}
+	return math.Float64frombits(p.order.Uint64(b)), nil
+}
+
+// listCount reads the length of a list property.
+func (p *plyReader) listCount(property *plyProperty) (int, error) {
+	count, err := p.value(property.countType)
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 || count > math.MaxInt32 {
+		return 0, p.fail(fmt.Errorf("%w: list of %v values", ErrPLYData, count))
+	}
+	return int(count), nil
+}
+
+// skipProperty reads a property whose value isn't used.
+func (p *plyReader) skipProperty(property *plyProperty) error {
+	count := 1
+	if property.list {
+		var err error
+		if count, err = p.listCount(property); err != nil {
+			return err
+		}
+	}
+	for ; count > 0; count-- {
+		if _, err := p.value(property.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *plyReader) readElement(element *plyElement) error {
+	p.elementName = element.name
+	switch {
+	case element.name == "vertex" && p.mesh.Vertices == nil:
+		return p.readVertices(element)
+	case element.name == "face" && !p.hasFaces:
+		return p.readFaces(element)
+	}
+	for p.elementIndex = 0; p.elementIndex < element.count; p.elementIndex++ {
+		if err := p.nextElement(); err != nil {
+			return err
+		}
+		for i := range element.properties {
+			if err := p.skipProperty(&element.properties[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *plyReader) readVertices(element *plyElement) error {
+	// Attribute of every property, or -1 to skip it
+	slots := make([]int, len(element.properties))
+	var has [plySlots]bool
+	for i, property := range element.properties {
+		slot, found := plyVertexProperties[property.name]
+		if !found || property.list || has[slot] {
+			slots[i] = -1
+			continue
+		}
+		slots[i] = slot
+		has[slot] = true
+	}
+	if !has[plyX] || !has[plyY] || !has[plyZ] {
+		p.elementIndex = 0
+		return p.fail(fmt.Errorf("%w: vertices without x, y and z", ErrPLYData))
+	}
+	p.hasNormals = has[plyNX] || has[plyNY] || has[plyNZ]
+	p.hasColors = has[plyRed] || has[plyGreen] || has[plyBlue] || has[plyAlpha]
+	p.hasUvs = has[plyU] || has[plyV]
+
+	m := &p.mesh
+	reserve := min(element.count, 1<<20)
+	m.Vertices = make([]mgl32.Vec3, 0, reserve)
+	if p.hasNormals {
+		m.Normals = make([]mgl32.Vec3, 0, reserve)
+	}
+	if p.hasColors {
+		m.Colors = make([]mgl32.Vec4, 0, reserve)
+	}
+	if p.hasUvs {
+		m.Uvs = make([]mgl32.Vec2, 0, reserve)
+	}
+
+	for p.elementIndex = 0; p.elementIndex < element.count; p.elementIndex++ {
+		if err := p.nextElement(); err != nil {
+			return err
+		}
+		// Colors are opaque unless they have alpha
+		var v [plySlots]float32
+		v[plyAlpha] = 1
+		for i := range element.properties {
+			property := &element.properties[i]
+			if slots[i] < 0 {
+				if err := p.skipProperty(property); err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := p.value(property.typ)
+			if err != nil {
+				return err
+			}
+			if slots[i] >= plyRed && slots[i] <= plyAlpha {
+				value /= float64(property.typ.maxColor())
+			}
+			v[slots[i]] = float32(value)
+		}
+
+		m.Vertices = append(m.Vertices, mgl32.Vec3{v[plyX], v[plyY], v[plyZ]})
+		if p.hasNormals {
+			m.Normals = append(m.Normals, mgl32.Vec3{v[plyNX], v[plyNY], v[plyNZ]})
+		}
+		if p.hasColors {
+			m.Colors = append(m.Colors, mgl32.Vec4{v[plyRed], v[plyGreen], v[plyBlue], v[plyAlpha]})
+		}
+		if p.hasUvs {
+			m.Uvs = append(m.Uvs, p.opts.FlipV.Apply(mgl32.Vec2{v[plyU], v[plyV]}))
+		}
+	}
+	return nil
+}
+
+func (p *plyReader) readFaces(element *plyElement) error {
+	indices := -1
+	for i, property := range element.properties {
+		if property.list && (property.name == "vertex_indices" || property.name == "vertex_index") {
+			indices = i
+			break
+		}
+	}
+	if indices < 0 {
+		p.elementIndex = 0
+		return p.fail(fmt.Errorf("%w: faces without vertex_indices", ErrPLYData))
+	}
+	p.hasFaces = true
+
+	for p.elementIndex = 0; p.elementIndex < element.count; p.elementIndex++ {
+		if err := p.nextElement(); err != nil {
+			return err
+		}
+		for i := range element.properties {
+			property := &element.properties[i]
+			if i != indices {
+				if err := p.skipProperty(property); err != nil {
+					return err
+				}
+				continue
+			}
+			count, err := p.listCount(property)
+			if err != nil {
+				return err
+			}
+			for k := 0; k < count; k++ {
+				index, err := p.value(property.typ)
+				if err != nil {
+					return err
+				}
+				if index < 0 || index > math.MaxUint32 {
+					return p.fail(fmt.Errorf("%w: vertex %v", ErrPLYIndex, index))
+				}
+				p.faces = append(p.faces, uint32(index))
+			}
+			p.faceSizes = append(p.faceSizes, count)
+		}
+	}
+	return nil
+}
+
+// finish triangulates the faces and applies the post-processing options.
+func (p *plyReader) finish() (Mesh, error) {
+	m := &p.mesh
+	if !p.hasFaces {
+		m.Indices = []uint32{}
+		return *m, nil
+	}
+
+	p.elementName = "face"
+	m.Indices = make([]uint32, 0, len(p.faces))
+	corners := p.faces
+	for face, size := range p.faceSizes {
+		p.elementIndex = face
+		polygon := corners[:size]
+		corners = corners[size:]
+		for _, index := range polygon {
+			if int(index) >= len(m.Vertices) {
+				return Mesh{}, p.fail(fmt.Errorf("%w: vertex %d", ErrPLYIndex, index))
+			}
+		}
+		// Faces of fewer than three vertices draw nothing
+		if size < 3 {
+			continue
+		}
+
+		m.Polygons++
+		if size == 3 {
+			m.Indices = append(m.Indices, polygon...)
+			continue
+		}
+		m.Triangulated++
+		p.polygon = p.polygon[:0]
+		for _, index := range polygon {
+			p.polygon = append(p.polygon, m.Vertices[index])
+		}
+		for _, k := range p.triangulator.triangulate(p.polygon) {
+			m.Indices = append(m.Indices, polygon[k])
+		}
+	}
+
+	mesh := *m
+	if mesh.Normals == nil && p.opts.Normals != nil {
+		mesh = GenerateNormals(mesh, *p.opts.Normals)
+	}
+	if !p.opts.Index {
+		mesh = UnindexMesh(mesh)
+	}
+	return mesh, nil
+}
+
+// LoadPLYFile opens and parses the PLY file at path.
+func LoadPLYFile(path string, opts *PLYOptions) (Mesh, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer f.Close()
+
+	return ReadPLY(f, path, opts)
+}
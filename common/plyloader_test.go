@@ -0,0 +1,217 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// plyValue is a value of a PLY test file, written as its type in binary
+// files.
+type plyValue struct {
+	typ plyType
+	v   float64
+}
+
+// plyFile returns a PLY file of format whose header is header, which has a
+// %s verb for the format, and whose elements are rows.
+func plyFile(format, header string, rows [][]plyValue) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, header, format)
+	var order binary.AppendByteOrder = binary.LittleEndian
+	if format == "binary_big_endian" {
+		order = binary.BigEndian
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			if format == "ascii" {
+				if i > 0 {
+					b.WriteByte(' ')
+				}
+				fmt.Fprint(&b, value.v)
+				continue
+			}
+			switch value.typ {
+			case plyInt8, plyUint8:
+				b.WriteByte(byte(int(value.v)))
+			case plyInt16, plyUint16:
+				b.Write(order.AppendUint16(nil, uint16(int(value.v))))
+			case plyInt32, plyUint32:
+				b.Write(order.AppendUint32(nil, uint32(int(value.v))))
+			case plyFloat32:
+				b.Write(order.AppendUint32(nil, math.Float32bits(float32(value.v))))
+			case plyFloat64:
+				b.Write(order.AppendUint64(nil, math.Float64bits(value.v)))
+			}
+		}
+		if format == "ascii" {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+// plyQuadHeader describes a quad and a triangle sharing an edge, with 8 bit
+// colors, a 16 bit alpha and texture coordinates. Faces have a property
+// before their indices, and edges are skipped.
+const plyQuadHeader = `ply
+format %s 1.0
+comment a quad and a triangle
+element vertex 5
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+property ushort alpha
+property float s
+property float t
+element face 2
+property uchar flags
+property list uchar int vertex_indices
+element edge 1
+property int vertex1
+property int vertex2
+end_header
+`
+
+// plyQuad returns the rows of plyQuadHeader, with last as the last index of
+// the triangle.
+func plyQuad(last float64) [][]plyValue {
+	vertex := func(x, y, r, g, b, a, s, t float64) []plyValue {
+		return []plyValue{
+			{plyFloat32, x}, {plyFloat32, y}, {plyFloat32, 0},
+			{plyUint8, r}, {plyUint8, g}, {plyUint8, b}, {plyUint16, a},
+			{plyFloat32, s}, {plyFloat32, t},
+		}
+	}
+	return [][]plyValue{
+		vertex(0, 0, 255, 0, 0, 65535, 0, 0),
+		vertex(1, 0, 0, 255, 0, 65535, 1, 0),
+		vertex(1, 1, 0, 0, 255, 65535, 1, 1),
+		vertex(0, 1, 255, 255, 255, 65535, 0, 1),
+		vertex(2, 0.5, 51, 102, 153, 0, 0.5, 0.25),
+		{{plyUint8, 7}, {plyUint8, 4}, {plyInt32, 0}, {plyInt32, 1}, {plyInt32, 2}, {plyInt32, 3}},
+		{{plyUint8, 0}, {plyUint8, 3}, {plyInt32, 1}, {plyInt32, 4}, {plyInt32, last}},
+		{{plyInt32, 0}, {plyInt32, 1}},
+	}
+}
+
+var plyFormats = []string{"ascii", "binary_little_endian", "binary_big_endian"}
+
+func TestReadPLY(t *testing.T) {
+	want := Mesh{
+		Indices:  []uint32{0, 1, 2, 0, 2, 3, 1, 4, 2},
+		Vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {2, 0.5, 0}},
+		Uvs:      []mgl32.Vec2{{0, 1}, {1, 1}, {1, 0}, {0, 0}, {0.5, 0.75}},
+		Colors:   []mgl32.Vec4{{1, 0, 0, 1}, {0, 1, 0, 1}, {0, 0, 1, 1}, {1, 1, 1, 1}, {0.2, 0.4, 0.6, 0}},
+		Polygons: 2,
+		// The quad is split in two
+		Triangulated: 1,
+	}
+	for _, format := range plyFormats {
+		data := plyFile(format, plyQuadHeader, plyQuad(2))
+		got, err := ReadPLY(bytes.NewReader(data), "quad.ply", &PLYOptions{Index: true, FlipV: VFlipOneMinus})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", format, got, want)
+		}
+
+		// Unindexed, with generated normals
+		got, err = ReadPLY(bytes.NewReader(data), "quad.ply", &PLYOptions{Normals: &NormalOptions{}})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got.Indices != nil || len(got.Vertices) != 9 || len(got.Normals) != 9 {
+			t.Errorf("%s unindexed: %d indices, %d vertices and %d normals", format, len(got.Indices), len(got.Vertices), len(got.Normals))
+		}
+		for _, normal := range got.Normals {
+			if normal != (mgl32.Vec3{0, 0, 1}) {
+				t.Errorf("%s unindexed: normal %v", format, normal)
+			}
+		}
+	}
+}
+
+func TestReadPLYPointCloud(t *testing.T) {
+	const header = `ply
+format %s 1.0
+element vertex 3
+property double x
+property double y
+property double z
+property float nx
+property float ny
+property float nz
+end_header
+`
+	rows := [][]plyValue{
+		{{plyFloat64, 1}, {plyFloat64, 2}, {plyFloat64, 3}, {plyFloat32, 0}, {plyFloat32, 0}, {plyFloat32, 1}},
+		{{plyFloat64, 4}, {plyFloat64, 5}, {plyFloat64, 6}, {plyFloat32, 0}, {plyFloat32, 1}, {plyFloat32, 0}},
+		{{plyFloat64, 7}, {plyFloat64, 8}, {plyFloat64, 9}, {plyFloat32, 1}, {plyFloat32, 0}, {plyFloat32, 0}},
+	}
+	want := Mesh{
+		Indices:  []uint32{},
+		Vertices: []mgl32.Vec3{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}},
+		Normals:  []mgl32.Vec3{{0, 0, 1}, {0, 1, 0}, {1, 0, 0}},
+	}
+	for _, format := range plyFormats {
+		// Point clouds stay indexed, without triangles
+		got, err := ReadPLY(bytes.NewReader(plyFile(format, header, rows)), "points.ply", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", format, got, want)
+		}
+	}
+}
+
+func TestReadPLYErrors(t *testing.T) {
+	for _, format := range plyFormats {
+		// An index past the vertices, or a negative one, in the second face
+		for _, last := range []float64{5, -1} {
+			data := plyFile(format, plyQuadHeader, plyQuad(last))
+			_, err := ReadPLY(bytes.NewReader(data), "quad.ply", nil)
+			var plyErr *PLYError
+			if !errors.As(err, &plyErr) || !errors.Is(err, ErrPLYIndex) || plyErr.Element != "face" || plyErr.Index != 1 {
+				t.Errorf("%s with index %v: got %v, want an index error in face 1", format, last, err)
+			}
+		}
+
+		// Cutting the body anywhere before its last value fails
+		data := plyFile(format, plyQuadHeader, plyQuad(2))
+		for n := len(plyQuadHeader) - 2 + len(format); n < len(data)-1; n++ {
+			_, err := ReadPLY(bytes.NewReader(data[:n]), "quad.ply", nil)
+			if !errors.Is(err, ErrPLYData) {
+				t.Errorf("%s truncated to %d bytes: got %v, want %v", format, n, err, ErrPLYData)
+			}
+		}
+	}
+
+	for _, header := range []string{
+		"",
+		"obj\nformat ascii 1.0\nend_header\n",
+		"ply\nformat binary_middle_endian 1.0\nend_header\n",
+		"ply\nformat ascii 2.0\nend_header\n",
+		"ply\nproperty float x\nformat ascii 1.0\nend_header\n",
+		"ply\nformat ascii 1.0\nelement vertex -1\nend_header\n",
+		"ply\nformat ascii 1.0\nelement face 1\nproperty list float int vertex_indices\nend_header\n",
+		"ply\nelement vertex 0\nend_header\n",
+		"ply\nformat ascii 1.0\nelement vertex 0\n",
+	} {
+		_, err := ReadPLY(strings.NewReader(header), "header.ply", nil)
+		if !errors.Is(err, ErrPLYHeader) {
+			t.Errorf("%q: got %v, want %v", header, err, ErrPLYHeader)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package common
+
+import (
+	"container/heap"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// SimplifyOptions controls Simplify. At least one of the limits should be
+// set, otherwise the mesh is simplified as far as it can be.
+type SimplifyOptions struct {
+	// TargetTriangles stops simplifying once the mesh has no more triangles
+	// than this. 0 means no limit.
+	TargetTriangles int
+	// MaxError stops before a collapse that would move the surface further
+	// than this, in model units, on average around the collapsed vertex.
+	// 0 means no limit.
+	MaxError float32
+}
+
+// Weight of the planes that keep borders, UV seams and material boundaries
+// in place, relative to the planes of the triangles.
+const simplifyBoundaryWeight = 10
+
+// Simplify returns a copy of m with fewer triangles, removed by collapsing
+// edges in the order of the quadric error metric, which keeps the shape of
+// the surface as close as possible to the original.
+//
+// Edges are collapsed into one of their vertices, so vertices keep their
+// attributes. Vertices on open borders only move along the border, and
+// vertices on UV or normal seams only along the seam, with every vertex of
+// the seam following, so textures don't tear. Sub-meshes and smoothing
+// groups follow their triangles.
+func Simplify(m Mesh, opts SimplifyOptions) Mesh {
+	indexed := m.Indices != nil
+	s := newSimplifier(IndexMesh(m))
+	s.run(opts)
+
+	simplified := s.mesh
+	simplified.Indices = make([]uint32, 0, 3*len(s.triangles))
+	for _, triangle := range s.triangles {
+		simplified.Indices = append(simplified.Indices, triangle[:]...)
+	}
+	out, _ := keepTriangles(simplified, func(t int, a, b, c uint32) bool {
+		return s.alive[t]
+	})
+	// Drop the vertices no triangle uses anymore
+	if !indexed {
+		return UnindexMesh(out)
+	}
+	return IndexMesh(out)
+}
+
+// GenerateLODs returns one simplified copy of m per ratio, each with about
+// that fraction of the triangles of m. Each level is simplified from the one
+// before, so ratios should be decreasing.
+func GenerateLODs(m Mesh, ratios []float32) []Mesh {
+	lods := make([]Mesh, len(ratios))
+	triangleCount := m.TriangleCount()
+	previous := m
+	for i, ratio := range ratios {
+		target := int(ratio * float32(triangleCount))
+		lods[i] = Simplify(previous, SimplifyOptions{TargetTriangles: max(target, 1)})
+		previous = lods[i]
+	}
+	return lods
+}
+
+// quadric is the symmetric matrix of a sum of squared distances to planes,
+// stored as a2 ab ac ad b2 bc bd c2 cd d2.
+type quadric [10]float64
+
+func planeQuadric(n [3]float64, d, weight float64) quadric {
+	a, b, c := n[0], n[1], n[2]
+	return quadric{
+		weight * a * a, weight * a * b, weight * a * c, weight * a * d,
+		weight * b * b, weight * b * c, weight * b * d,
+		weight * c * c, weight * c * d,
+		weight * d * d,
+	}
+}
+
+func (q *quadric) add(o *quadric) {
+	for i := range q {
+		q[i] += o[i]
+	}
+}
+
+// eval returns the weighted sum of squared distances from p to the planes.
+func (q *quadric) eval(p mgl32.Vec3) float64 {
+	x, y, z := float64(p[0]), float64(p[1]), float64(p[2])
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+// collapse is a candidate move of the vertices at position from onto those at
+// position to. It is stale once either position changed since it was made.
+type collapse struct {
+	cost               float64
+	from, to           int32
+	fromStamp, toStamp int
+}
+
+type collapseQueue []collapse
+
+func (q collapseQueue) Len() int           { return len(q) }
+func (q collapseQueue) Less(i, j int) bool { return q[i].cost < q[j].cost }
+func (q collapseQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *collapseQueue) Push(x any)        { *q = append(*q, x.(collapse)) }
+func (q *collapseQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// simplifier collapses the edges of an indexed mesh. Topology works on
+// positions, so that vertices split by a seam move together.
+type simplifier struct {
+	mesh      Mesh
+	positions []int32      // position of every vertex
+	points    []mgl32.Vec3 // every distinct position
+	triangles [][3]uint32
+	alive     []bool
+	live      int
+
+	quadrics []quadric
+	weights  []float64 // area of the triangles in each quadric
+	stamps   []int
+	removed  []bool
+	around   [][]int // triangles around every position, some dead
+	queue    collapseQueue
+
+	// Scratch space of canCollapse
+	remap      map[uint32]uint32
+	edgeUses   map[int32]int
+	neighbours map[int32]bool
+}
+
+func newSimplifier(m Mesh) *simplifier {
+	ids, firsts := positionIDs(m.Vertices)
+	s := &simplifier{
+		mesh:       m,
+		positions:  ids,
+		points:     make([]mgl32.Vec3, len(firsts)),
+		triangles:  make([][3]uint32, m.TriangleCount()),
+		alive:      make([]bool, m.TriangleCount()),
+		quadrics:   make([]quadric, len(firsts)),
+		weights:    make([]float64, len(firsts)),
+		stamps:     make([]int, len(firsts)),
+		removed:    make([]bool, len(firsts)),
+		around:     make([][]int, len(firsts)),
+		remap:      make(map[uint32]uint32),
+		edgeUses:   make(map[int32]int),
+		neighbours: make(map[int32]bool),
+	}
+	for id, first := range firsts {
+		s.points[id] = m.Vertices[first]
+	}
+
+	// Sub-mesh of every triangle, to keep material boundaries
+	subMeshes := make([]int, len(s.triangles))
+	for i, subMesh := range m.SubMeshes {
+		for t := subMesh.First / 3; t < (subMesh.First+subMesh.Count)/3 && t < len(subMeshes); t++ {
+			subMeshes[t] = i + 1
+		}
+	}
+
+	edges := make(map[[2]int32][]int)
+	for t := range s.triangles {
+		a, b, c := m.Triangle(t)
+		s.triangles[t] = [3]uint32{a, b, c}
+		p := [3]int32{ids[a], ids[b], ids[c]}
+		if p[0] == p[1] || p[1] == p[2] || p[2] == p[0] {
+			continue
+		}
+		s.alive[t] = true
+		s.live++
+
+		normal, area := s.triangleNormal(t)
+		if area > 0 {
+			q := planeQuadric(normal, -dot64(normal, s.points[p[0]]), area)
+			for _, id := range p {
+				s.quadrics[id].add(&q)
+				s.weights[id] += area
+			}
+		}
+		for k, id := range p {
+			s.around[id] = append(s.around[id], t)
+			key := edgeKey(id, p[(k+1)%3])
+			edges[key] = append(edges[key], t)
+		}
+	}
+
+	// Planes through boundary edges, perpendicular to their triangle, keep
+	// them from moving sideways
+	for key, shared := range edges {
+		boundary := len(shared) != 2
+		if !boundary {
+			t, u := shared[0], shared[1]
+			boundary = subMeshes[t] != subMeshes[u] || s.edgeVertices(t, key) != s.edgeVertices(u, key)
+		}
+		if !boundary {
+			continue
+		}
+		for _, t := range shared {
+			normal, area := s.triangleNormal(t)
+			if area == 0 {
+				continue
+			}
+			p0, p1 := s.points[key[0]], s.points[key[1]]
+			edge := p1.Sub(p0)
+			n := mgl32.Vec3{float32(normal[0]), float32(normal[1]), float32(normal[2])}
+			perpendicular := normalize(edge.Cross(n))
+			plane := [3]float64{float64(perpendicular[0]), float64(perpendicular[1]), float64(perpendicular[2])}
+			q := planeQuadric(plane, -dot64(plane, p0), simplifyBoundaryWeight*float64(edge.LenSqr()))
+			s.quadrics[key[0]].add(&q)
+			s.quadrics[key[1]].add(&q)
+		}
+	}
+
+	for key := range edges {
+		s.queue = append(s.queue, s.candidate(key[0], key[1]), s.candidate(key[1], key[0]))
+	}
+	heap.Init(&s.queue)
+	return s
+}
+
+// triangleNormal returns the unit normal and the area of triangle t.
+func (s *simplifier) triangleNormal(t int) ([3]float64, float64) {
+	c := s.triangles[t]
+	p0 := s.points[s.positions[c[0]]]
+	p1 := s.points[s.positions[c[1]]]
+	p2 := s.points[s.positions[c[2]]]
+	n := p1.Sub(p0).Cross(p2.Sub(p0))
+	length := float64(n.Len())
+	if length == 0 {
+		return [3]float64{}, 0
+	}
+	return [3]float64{float64(n[0]) / length, float64(n[1]) / length, float64(n[2]) / length}, length / 2
+}
+
+func dot64(n [3]float64, p mgl32.Vec3) float64 {
+	return n[0]*float64(p[0]) + n[1]*float64(p[1]) + n[2]*float64(p[2])
+}
+
+// edgeVertices returns the vertices triangle t uses at the ends of an edge,
+// in the order of the edge's positions.
+func (s *simplifier) edgeVertices(t int, key [2]int32) [2]uint32 {
+	var vertices [2]uint32
+	for _, v := range s.triangles[t] {
+		if s.positions[v] == key[0] {
+			vertices[0] = v
+		} else if s.positions[v] == key[1] {
+			vertices[1] = v
+		}
+	}
+	return vertices
+}
+
+// cost returns the mean squared distance the surface moves by when from is
+// collapsed onto to.
+func (s *simplifier) cost(from, to int32) float64 {
+	q := s.quadrics[from]
+	q.add(&s.quadrics[to])
+	weight := s.weights[from] + s.weights[to]
+	if weight == 0 {
+		weight = 1
+	}
+	return max(q.eval(s.points[to]), 0) / weight
+}
+
+func (s *simplifier) candidate(from, to int32) collapse {
+	return collapse{
+		cost:      s.cost(from, to),
+		from:      from,
+		to:        to,
+		fromStamp: s.stamps[from],
+		toStamp:   s.stamps[to],
+	}
+}
+
+func (s *simplifier) push(from, to int32) {
+	heap.Push(&s.queue, s.candidate(from, to))
+}
+
+func (s *simplifier) run(opts SimplifyOptions) {
+	maxCost := math.Inf(1)
+	if opts.MaxError > 0 {
+		maxCost = float64(opts.MaxError) * float64(opts.MaxError)
+	}
+	for s.queue.Len() > 0 && s.live > opts.TargetTriangles {
+		c := heap.Pop(&s.queue).(collapse)
+		if s.removed[c.from] || s.removed[c.to] || c.fromStamp != s.stamps[c.from] || c.toStamp != s.stamps[c.to] {
+			continue
+		}
+		if c.cost > maxCost {
+			break
+		}
+		if !s.canCollapse(c.from, c.to) {
+			continue
+		}
+		s.collapse(c.from, c.to)
+	}
+}
+
+// canCollapse checks that moving from onto to keeps borders and seams in
+// place, doesn't fold triangles over and doesn't pinch the surface. It
+// leaves in remap the vertex of to that replaces each vertex of from.
+func (s *simplifier) canCollapse(from, to int32) bool {
+	clear(s.remap)
+	clear(s.edgeUses)
+	clear(s.neighbours)
+
+	// Count how many triangles use each edge from from
+	edgeUses := s.edgeUses
+	for _, t := range s.around[from] {
+		if !s.alive[t] {
+			continue
+		}
+		for _, v := range s.triangles[t] {
+			if p := s.positions[v]; p != from {
+				edgeUses[p]++
+			}
+		}
+	}
+	borderEdges := 0
+	for _, uses := range edgeUses {
+		if uses == 1 {
+			borderEdges++
+		} else if uses > 2 {
+			// Non-manifold
+			return false
+		}
+	}
+	shared, found := edgeUses[to]
+	if !found {
+		return false
+	}
+	// Border vertices only move along the border, and vertices where
+	// borders meet don't move at all
+	if borderEdges != 0 && (borderEdges != 2 || shared != 1) {
+		return false
+	}
+	// Closed parts don't go below a tetrahedron, which would fold flat
+	if borderEdges == 0 && len(edgeUses) <= 3 {
+		return false
+	}
+
+	// Vertices around to, which must only be shared with from through the
+	// triangles of the edge
+	commonNeighbours := 0
+	for _, t := range s.around[to] {
+		if !s.alive[t] {
+			continue
+		}
+		for _, v := range s.triangles[t] {
+			p := s.positions[v]
+			if p != to && p != from && !s.neighbours[p] {
+				s.neighbours[p] = true
+				if edgeUses[p] > 0 {
+					commonNeighbours++
+				}
+			}
+		}
+	}
+	if commonNeighbours > shared {
+		return false
+	}
+
+	// Every vertex of from must share a triangle with a single vertex of to,
+	// which is the case along seams but not across them
+	for _, t := range s.around[from] {
+		if !s.alive[t] {
+			continue
+		}
+		var fromVertex, toVertex uint32
+		hasTo := false
+		for _, v := range s.triangles[t] {
+			switch s.positions[v] {
+			case from:
+				fromVertex = v
+			case to:
+				toVertex, hasTo = v, true
+			}
+		}
+		if !hasTo {
+			continue
+		}
+		if previous, found := s.remap[fromVertex]; found && previous != toVertex {
+			return false
+		}
+		s.remap[fromVertex] = toVertex
+	}
+	for _, t := range s.around[from] {
+		if !s.alive[t] {
+			continue
+		}
+		for _, v := range s.triangles[t] {
+			if s.positions[v] == from {
+				if _, found := s.remap[v]; !found {
+					return false
+				}
+			}
+		}
+	}
+
+	// Triangles that stay must not turn over
+	for _, t := range s.around[from] {
+		if !s.alive[t] || s.hasPosition(t, to) {
+			continue
+		}
+		before, _ := s.triangleNormal(t)
+		var p [3]mgl32.Vec3
+		for k, v := range s.triangles[t] {
+			p[k] = s.points[s.positions[v]]
+			if s.positions[v] == from {
+				p[k] = s.points[to]
+			}
+		}
+		after := p[1].Sub(p[0]).Cross(p[2].Sub(p[0]))
+		if isDegenerate(p[0], p[1], p[2]) || dot64(before, after) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *simplifier) hasPosition(t int, p int32) bool {
+	for _, v := range s.triangles[t] {
+		if s.positions[v] == p {
+			return true
+		}
+	}
+	return false
+}
+
+// collapse moves from onto to, using the vertices canCollapse chose.
+func (s *simplifier) collapse(from, to int32) {
+	for _, t := range s.around[from] {
+		if !s.alive[t] {
+			continue
+		}
+		if s.hasPosition(t, to) {
+			s.alive[t] = false
+			s.live--
+			continue
+		}
+		for k, v := range s.triangles[t] {
+			if s.positions[v] == from {
+				s.triangles[t][k] = s.remap[v]
+			}
+		}
+		s.around[to] = append(s.around[to], t)
+	}
+	s.around[from] = nil
+	s.removed[from] = true
+	s.quadrics[to].add(&s.quadrics[from])
+	s.weights[to] += s.weights[from]
+	s.stamps[to]++
+
+	// Drop dead triangles and queue the edges that changed
+	alive := s.around[to][:0]
+	for _, t := range s.around[to] {
+		if s.alive[t] {
+			alive = append(alive, t)
+		}
+	}
+	s.around[to] = alive
+	clear(s.neighbours)
+	for _, t := range alive {
+		for _, v := range s.triangles[t] {
+			if p := s.positions[v]; p != to && !s.neighbours[p] {
+				s.neighbours[p] = true
+				s.push(to, p)
+				s.push(p, to)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"testing"
+)
+
+func TestGenerateLODs(t *testing.T) {
+	m, err := LoadOBJFile(suzannePath, &OBJOptions{Index: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Suzanne has an edge shared by more than two triangles, which
+	// simplifying must not add to
+	source := ValidateMesh(m)
+	ratios := []float32{0.5, 0.25, 0.1}
+	lods := GenerateLODs(m, ratios)
+	if len(lods) != len(ratios) {
+		t.Fatalf("%d levels for %d ratios", len(lods), len(ratios))
+	}
+	for i, lod := range lods {
+		target := int(ratios[i] * float32(m.TriangleCount()))
+		if got := lod.TriangleCount(); got > target || got < target*9/10 {
+			t.Errorf("ratio %v: %d triangles, want %d", ratios[i], got, target)
+		}
+		if lod.Indices == nil {
+			t.Errorf("ratio %v: not indexed", ratios[i])
+		}
+		r := ValidateMesh(lod)
+		if len(r.NonManifold) > len(source.NonManifold) {
+			t.Errorf("ratio %v: %d non-manifold edges, up from %d", ratios[i], len(r.NonManifold), len(source.NonManifold))
+		}
+		if r.NonManifold = nil; !r.Valid() {
+			t.Errorf("ratio %v: %v", ratios[i], &r)
+		}
+	}
+
+	// Unindexed meshes stay so
+	lod := Simplify(UnindexMesh(m), SimplifyOptions{TargetTriangles: m.TriangleCount() / 2})
+	if lod.Indices != nil || lod.TriangleCount() > m.TriangleCount()/2 {
+		t.Errorf("unindexed: got %d indices for %d triangles", len(lod.Indices), lod.TriangleCount())
+	}
+}
+
+// seamGrid returns a flat square of n by n quads, whose texture coordinates
+// jump by 1 at x = n/2, so that the vertices of that column are split.
+func seamGrid(n int) Mesh {
+	var m Mesh
+	vertex := func(x, y, side int) uint32 {
+		m.Vertices = append(m.Vertices, mgl32.Vec3{float32(x), float32(y), 0})
+		m.Uvs = append(m.Uvs, mgl32.Vec2{float32(x)/float32(n) + float32(side), float32(y) / float32(n)})
+		return uint32(len(m.Vertices) - 1)
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			side := 0
+			if x >= n/2 {
+				side = 1
+			}
+			a, b, c, d := vertex(x, y, side), vertex(x+1, y, side), vertex(x+1, y+1, side), vertex(x, y+1, side)
+			m.Indices = append(m.Indices, a, b, c, a, c, d)
+		}
+	}
+	return IndexMesh(m)
+}
+
+func TestSimplifyKeepsBordersAndSeams(t *testing.T) {
+	const n = 8
+	grid := seamGrid(n)
+	// Only collapses that don't change the shape
+	m := Simplify(grid, SimplifyOptions{TargetTriangles: 1, MaxError: 1e-3})
+	if m.TriangleCount() >= grid.TriangleCount()/2 {
+		t.Errorf("%d triangles left of %d", m.TriangleCount(), grid.TriangleCount())
+	}
+	if r := ValidateMesh(m); !r.Valid() {
+		t.Errorf("%v", &r)
+	}
+
+	var area float32
+	for i := 0; i < m.TriangleCount(); i++ {
+		a, b, c := m.Triangle(i)
+		p0, p1, p2 := m.Vertices[a], m.Vertices[b], m.Vertices[c]
+		normal := p1.Sub(p0).Cross(p2.Sub(p0))
+		if normal.Z() <= 0 {
+			t.Errorf("triangle %v %v %v turned over", p0, p1, p2)
+		}
+		area += normal.Len() / 2
+
+		// Texture coordinates still match positions, and triangles stay on
+		// their side of the seam
+		var sides [3]float32
+		for k, v := range [3]uint32{a, b, c} {
+			p, uv := m.Vertices[v], m.Uvs[v]
+			sides[k] = uv.X() - p.X()/n
+			if sides[k] != 0 && sides[k] != 1 || uv.Y() != p.Y()/n {
+				t.Errorf("vertex %v has uv %v", p, uv)
+			}
+		}
+		if sides[0] != sides[1] || sides[1] != sides[2] {
+			t.Errorf("triangle %v %v %v crosses the seam", p0, p1, p2)
+		}
+	}
+	// Borders stay in place, so the square keeps its area
+	if math.Abs(float64(area-n*n)) > 1e-3 {
+		t.Errorf("area %v, want %v", area, n*n)
+	}
+	// Corners stay, and the seam keeps its ends
+	for _, corner := range []mgl32.Vec3{{0, 0, 0}, {n, 0, 0}, {n, n, 0}, {0, n, 0}, {n / 2, 0, 0}, {n / 2, n, 0}} {
+		found := false
+		for _, p := range m.Vertices {
+			found = found || p == corner
+		}
+		if !found {
+			t.Errorf("vertex %v removed", corner)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"io"
+	"math"
+	"os"
+)
+
+// ErrSTLFormat is wrapped by STLError.
+var ErrSTLFormat = errors.New("malformed STL")
+
+// STLOptions controls how ReadSTL builds its Mesh. A nil *STLOptions is the
+// same as the zero value.
+type STLOptions struct {
+	// Normals, if not nil, replaces the facet normals with normals computed
+	// from the welded surface, to smooth curved parts of the model.
+	Normals *NormalOptions
+	// FacetNormals keeps the normal of each facet, splitting vertices where
+	// facets of different normals meet so that edges between them stay
+	// hard. The mesh is then only welded within flat areas.
+	FacetNormals bool
+}
+
+// STLError reports where in an STL file parsing failed. Line is the line of
+// ASCII files, or 0 for binary ones.
+type STLError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *STLError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *STLError) Unwrap() error {
+	return e.Err
+}
+
+// Binary STL files are an 80 byte header, a triangle count and 50 bytes per
+// triangle: normal, three vertices and an attribute word.
+const (
+	stlHeaderSize   = 80
+	stlTriangleSize = 50
+)
+
+// ReadSTL parses an ASCII or binary STL file from r. name is only used in
+// error messages.
+//
+// Every triangle gets the normal of its facet, computed from the vertices
+// when the file leaves it zero. The mesh is then indexed, welding the
+// vertices that have the same position, and each vertex gets the average
+// normal of the facets around it.
+func ReadSTL(r io.Reader, name string, opts *STLOptions) (Mesh, error) {
+	if opts == nil {
+		opts = &STLOptions{}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Mesh{}, err
+	}
+
+	// Binary files may start with "solid" too, so their size decides
+	var mesh Mesh
+	if isBinarySTL(data) {
+		mesh = readBinarySTL(data)
+	} else if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		if mesh, err = readASCIISTL(data, name); err != nil {
+			return Mesh{}, err
+		}
+	} else {
+		return Mesh{}, &STLError{File: name, Err: fmt.Errorf("%w: size doesn't match the triangle count", ErrSTLFormat)}
+	}
+
+	if opts.Normals != nil {
+		return IndexMesh(GenerateNormals(mesh, *opts.Normals)), nil
+	}
+	return weldFacets(mesh, opts.FacetNormals), nil
+}
+
+// stlSameNormal is the cosine of the largest angle between the normals of
+// facets that share vertices with FacetNormals. Normals computed from the
+// vertices of coplanar facets differ by rounding.
+const stlSameNormal = 0.9999
+
+// weldFacets indexes the triangles of m, which isn't indexed, welding the
+// vertices at the same position. Each vertex gets the average normal of the
+// facets that meet at it, or with hard set, is only shared by facets of
+// nearly the same normal.
+func weldFacets(m Mesh, hard bool) Mesh {
+	out := m
+	out.clearVertices()
+	out.Indices = make([]uint32, 0, len(m.Vertices))
+
+	// Vertices added at each position
+	at := make(map[mgl32.Vec3][]uint32)
+	for i, position := range m.Vertices {
+		normal := m.Normals[i]
+		index, found := uint32(0), false
+		for _, j := range at[position] {
+			if !hard || normalize(out.Normals[j]).Dot(normal) >= stlSameNormal {
+				index, found = j, true
+				break
+			}
+		}
+		if !found {
+			index = uint32(len(out.Vertices))
+			out.Vertices = append(out.Vertices, position)
+			out.Normals = append(out.Normals, mgl32.Vec3{})
+			at[position] = append(at[position], index)
+		}
+		out.Normals[index] = out.Normals[index].Add(normal)
+		out.Indices = append(out.Indices, index)
+	}
+	for i, normal := range out.Normals {
+		out.Normals[i] = normalize(normal)
+	}
+	return out
+}
+
+func isBinarySTL(data []byte) bool {
+	if len(data) < stlHeaderSize+4 {
+		return false
+	}
+	count := uint64(binary.LittleEndian.Uint32(data[stlHeaderSize:]))
+	return uint64(len(data)) == stlHeaderSize+4+count*stlTriangleSize
+}
+
+func readBinarySTL(data []byte) Mesh {
+	count := int(binary.LittleEndian.Uint32(data[stlHeaderSize:]))
+	mesh := Mesh{
+		Vertices: make([]mgl32.Vec3, 0, 3*count),
+		Normals:  make([]mgl32.Vec3, 0, 3*count),
+	}
+	data = data[stlHeaderSize+4:]
+
+	var values [12]float32
+	for t := 0; t < count; t++ {
+		triangle := data[t*stlTriangleSize:]
+		for i := range values {
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(triangle[4*i:]))
+		}
+		// The attribute word has no standard meaning and is skipped
+		mesh.addFacet(mgl32.Vec3{values[0], values[1], values[2]}, []mgl32.Vec3{
+			{values[3], values[4], values[5]},
+			{values[6], values[7], values[8]},
+			{values[9], values[10], values[11]},
+		}, nil)
+	}
+	return mesh
+}
+
+func readASCIISTL(data []byte, name string) (Mesh, error) {
+	var mesh Mesh
+	var fields [][]byte
+	var normal mgl32.Vec3
+	var polygon []mgl32.Vec3
+	var t triangulator
+	inFacet := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields = splitFields(fields, scanner.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		fail := func(token []byte) error {
+			return &STLError{File: name, Line: line, Err: fmt.Errorf("%w: %q", ErrSTLFormat, token)}
+		}
+
+		switch string(fields[0]) {
+		case "facet":
+			if inFacet || len(fields) != 5 || string(fields[1]) != "normal" {
+				return Mesh{}, fail(fields[0])
+			}
+			for i := range normal {
+				var ok bool
+				if normal[i], ok = parseFloat(fields[2+i]); !ok {
+					return Mesh{}, fail(fields[2+i])
+				}
+			}
+			polygon = polygon[:0]
+			inFacet = true
+		case "vertex":
+			if !inFacet || len(fields) != 4 {
+				return Mesh{}, fail(fields[0])
+			}
+			var vertex mgl32.Vec3
+			for i := range vertex {
+				var ok bool
+				if vertex[i], ok = parseFloat(fields[1+i]); !ok {
+					return Mesh{}, fail(fields[1+i])
+				}
+			}
+			polygon = append(polygon, vertex)
+		case "endfacet":
+			if !inFacet {
+				return Mesh{}, fail(fields[0])
+			}
+			if len(polygon) < 3 {
+				return Mesh{}, &STLError{File: name, Line: line, Err: fmt.Errorf("%w: facet with %d vertices", ErrSTLFormat, len(polygon))}
+			}
+			mesh.addFacet(normal, polygon, &t)
+			inFacet = false
+		case "solid", "endsolid", "outer", "endloop":
+			// Solid names are dropped and all solids end up in one mesh
+		default:
+			return Mesh{}, fail(fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Mesh{}, &STLError{File: name, Line: line + 1, Err: err}
+	}
+	if inFacet {
+		return Mesh{}, &STLError{File: name, Line: line, Err: fmt.Errorf("%w: unexpected end of file", ErrSTLFormat)}
+	}
+	return mesh, nil
+}
+
+// addFacet appends the triangles of a facet, splitting it with t if it has
+// more than three vertices, all with the facet normal.
+func (m *Mesh) addFacet(normal mgl32.Vec3, polygon []mgl32.Vec3, t *triangulator) {
+	m.Polygons++
+	if normal.Len() == 0 || math.IsNaN(float64(normal.Len())) {
+		normal = newellNormal(polygon)
+	}
+	normal = normalize(normal)
+
+	if len(polygon) == 3 {
+		m.Vertices = append(m.Vertices, polygon...)
+		m.Normals = append(m.Normals, normal, normal, normal)
+		return
+	}
+	m.Triangulated++
+	for _, i := range t.triangulate(polygon) {
+		m.Vertices = append(m.Vertices, polygon[i])
+		m.Normals = append(m.Normals, normal)
+	}
+}
+
+// LoadSTLFile opens and parses the STL file at path.
+func LoadSTLFile(path string, opts *STLOptions) (Mesh, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer f.Close()
+
+	return ReadSTL(f, path, opts)
+}
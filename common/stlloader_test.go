@@ -0,0 +1,58 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadSTLWeld(t *testing.T) {
+	box, err := LoadOBJFile("../tutorial04/box.obj", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ascii := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WriteSTL(&buf, box, &STLWriteOptions{ASCII: ascii, Name: "box"}); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := ReadSTL(bytes.NewReader(buf.Bytes()), "box.stl", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Vertices) != 8 || len(m.Indices) != 36 {
+			t.Errorf("ascii %v: %d vertices and %d indices, want 8 and 36", ascii, len(m.Vertices), len(m.Indices))
+		}
+		if r := ValidateMesh(m); !r.Valid() {
+			t.Errorf("ascii %v: %v", ascii, &r)
+		}
+		// Every edge joins two triangles through the same vertices
+		edges := make(map[[2]uint32]int)
+		for i := 0; i < m.TriangleCount(); i++ {
+			a, b, c := m.Triangle(i)
+			for _, e := range [][2]uint32{{a, b}, {b, c}, {c, a}} {
+				edges[[2]uint32{min(e[0], e[1]), max(e[0], e[1])}]++
+			}
+		}
+		for e, n := range edges {
+			if n != 2 {
+				t.Errorf("ascii %v: edge %v used by %d triangles", ascii, e, n)
+			}
+		}
+		// Normals point out of the box, whose center is the origin
+		for i, normal := range m.Normals {
+			if normal.Dot(m.Vertices[i]) <= 0 || normal.Len() < 0.999 || normal.Len() > 1.001 {
+				t.Errorf("ascii %v: vertex %v has normal %v", ascii, m.Vertices[i], normal)
+			}
+		}
+
+		// Facet normals split the corners, one vertex per face
+		m, err = ReadSTL(bytes.NewReader(buf.Bytes()), "box.stl", &STLOptions{FacetNormals: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Vertices) != 24 {
+			t.Errorf("ascii %v with facet normals: %d vertices, want 24", ascii, len(m.Vertices))
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// STLWriteOptions controls WriteSTL. A nil *STLWriteOptions is the same as
+// the zero value.
+type STLWriteOptions struct {
+	// ASCII writes a text file instead of a binary one.
+	ASCII bool
+	// Name is the solid name of ASCII files, and the header of binary ones.
+	Name string
+}
+
+// WriteSTL writes the triangles of m to w as an STL file. Facet normals are
+// computed from the triangles, since STL has no vertex normals.
+func WriteSTL(w io.Writer, m Mesh, opts *STLWriteOptions) error {
+	if opts == nil {
+		opts = &STLWriteOptions{}
+	}
+	bw := bufio.NewWriter(w)
+	if opts.ASCII {
+		writeASCIISTL(bw, &m, opts.Name)
+	} else if err := writeBinarySTL(bw, &m, opts.Name); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeBinarySTL(bw *bufio.Writer, m *Mesh, name string) error {
+	// Readers take headers starting with "solid" for ASCII files
+	if strings.HasPrefix(name, "solid") {
+		name = "binary " + name
+	}
+	var header [stlHeaderSize + 4]byte
+	copy(header[:stlHeaderSize], name)
+	count := m.TriangleCount()
+	if uint64(count) > math.MaxUint32 {
+		return ErrSTLFormat
+	}
+	binary.LittleEndian.PutUint32(header[stlHeaderSize:], uint32(count))
+	bw.Write(header[:])
+
+	var triangle [stlTriangleSize]byte
+	for t := 0; t < count; t++ {
+		a, b, c := m.Triangle(t)
+		p0, p1, p2 := m.Vertices[a], m.Vertices[b], m.Vertices[c]
+		normal := normalize(p1.Sub(p0).Cross(p2.Sub(p0)))
+		values := [12]float32{
+			normal[0], normal[1], normal[2],
+			p0[0], p0[1], p0[2],
+			p1[0], p1[1], p1[2],
+			p2[0], p2[1], p2[2],
+		}
+		for i, f := range values {
+			binary.LittleEndian.PutUint32(triangle[4*i:], math.Float32bits(f))
+		}
+		bw.Write(triangle[:])
+	}
+	return nil
+}
+
+func writeASCIISTL(bw *bufio.Writer, m *Mesh, name string) {
+	var buf []byte
+	writeVector := func(prefix string, v [3]float32) {
+		buf = append(buf[:0], prefix...)
+		for _, f := range v {
+			buf = append(buf, ' ')
+			buf = strconv.AppendFloat(buf, float64(f), 'e', -1, 32)
+		}
+		buf = append(buf, '\n')
+		bw.Write(buf)
+	}
+
+	bw.WriteString("solid " + name + "\n")
+	for t := 0; t < m.TriangleCount(); t++ {
+		a, b, c := m.Triangle(t)
+		p0, p1, p2 := m.Vertices[a], m.Vertices[b], m.Vertices[c]
+		writeVector("facet normal", normalize(p1.Sub(p0).Cross(p2.Sub(p0))))
+		bw.WriteString("  outer loop\n")
+		writeVector("    vertex", p0)
+		writeVector("    vertex", p1)
+		writeVector("    vertex", p2)
+		bw.WriteString("  endloop\nendfacet\n")
+	}
+	bw.WriteString("endsolid " + name + "\n")
+}
+
+// SaveSTLFile writes m to the STL file at path.
+func SaveSTLFile(path string, m Mesh, opts *STLWriteOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteSTL(f, m, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"errors"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// ErrNoTangentSpace is returned by ComputeTangents for meshes that lack the
+// texture coordinates or normals a tangent basis is derived from.
+var ErrNoTangentSpace = errors.New("mesh needs uvs and normals for tangents")
+
+// ComputeTangents returns a copy of m with a tangent and bitangent for every
+// vertex, for normal mapping. Tangents follow the direction of increasing U,
+// are made orthogonal to the normal and averaged over every triangle sharing
+// the vertex, so index the mesh first to get smooth tangents. The w component
+// of each tangent is -1 when the UV mapping is mirrored, and the bitangent is
+// cross(normal, tangent) * w.
+func ComputeTangents(m Mesh) (Mesh, error) {
+	if m.Uvs == nil || m.Normals == nil {
+		return Mesh{}, ErrNoTangentSpace
+	}
+
+	tangents := make([]mgl32.Vec3, len(m.Vertices))
+	bitangents := make([]mgl32.Vec3, len(m.Vertices))
+	for t := 0; t < m.TriangleCount(); t++ {
+		a, b, c := m.Triangle(t)
+
+		// Edges of the triangle : position delta
+		deltaPos1 := m.Vertices[b].Sub(m.Vertices[a])
+		deltaPos2 := m.Vertices[c].Sub(m.Vertices[a])
+
+		// UV delta
+		deltaUV1 := m.Uvs[b].Sub(m.Uvs[a])
+		deltaUV2 := m.Uvs[c].Sub(m.Uvs[a])
+
+		det := deltaUV1[0]*deltaUV2[1] - deltaUV1[1]*deltaUV2[0]
+		if det == 0 {
+			// Degenerate UVs, nothing to learn from this triangle
+			continue
+		}
+		r := 1 / det
+		tangent := deltaPos1.Mul(deltaUV2[1]).Sub(deltaPos2.Mul(deltaUV1[1])).Mul(r)
+		bitangent := deltaPos2.Mul(deltaUV1[0]).Sub(deltaPos1.Mul(deltaUV2[0])).Mul(r)
+
+		// Accumulate on the three vertices, averaging shared ones
+		for _, i := range [3]uint32{a, b, c} {
+			tangents[i] = tangents[i].Add(tangent)
+			bitangents[i] = bitangents[i].Add(bitangent)
+		}
+	}
+
+	out := m
+	out.Tangents = make([]mgl32.Vec4, len(m.Vertices))
+	out.Bitangents = make([]mgl32.Vec3, len(m.Vertices))
+	for i := range m.Vertices {
+		n := normalize(m.Normals[i])
+
+		// Gram-Schmidt orthogonalize
+		t := normalize(tangents[i].Sub(n.Mul(n.Dot(tangents[i]))))
+		if t.Len() == 0 {
+			t = anyPerpendicular(n)
+		}
+
+		// Calculate handedness
+		w := float32(1)
+		if n.Cross(t).Dot(bitangents[i]) < 0 {
+			w = -1
+		}
+
+		out.Tangents[i] = t.Vec4(w)
+		out.Bitangents[i] = n.Cross(t).Mul(w)
+	}
+	return out, nil
+}
+
+// anyPerpendicular returns a unit vector orthogonal to n, for vertices whose
+// UVs don't define a tangent.
+func anyPerpendicular(n mgl32.Vec3) mgl32.Vec3 {
+	axis := mgl32.Vec3{1, 0, 0}
+	if n[0] > 0.9 || n[0] < -0.9 {
+		axis = mgl32.Vec3{0, 1, 0}
+	}
+	return normalize(axis.Sub(n.Mul(n.Dot(axis))))
+}
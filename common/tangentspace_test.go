@@ -0,0 +1,139 @@
+package common
+
+import (
+	"errors"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"testing"
+)
+
+// checkTangentBasis fails unless every tangent of m is a unit vector
+// orthogonal to the normal, and every bitangent is cross(normal, tangent)
+// times the handedness.
+func checkTangentBasis(t *testing.T, name string, m Mesh) {
+	t.Helper()
+	if len(m.Tangents) != len(m.Vertices) || len(m.Bitangents) != len(m.Vertices) {
+		t.Fatalf("%s: %d tangents and %d bitangents for %d vertices", name, len(m.Tangents), len(m.Bitangents), len(m.Vertices))
+	}
+	for i, tangent := range m.Tangents {
+		n := m.Normals[i].Normalize()
+		t3, w := tangent.Vec3(), tangent.W()
+		if math.Abs(float64(t3.Len()-1)) > 1e-4 || math.Abs(float64(t3.Dot(n))) > 1e-4 || (w != 1 && w != -1) {
+			t.Errorf("%s: vertex %d has normal %v and tangent %v", name, i, n, tangent)
+		}
+		if want := n.Cross(t3).Mul(w); !near(m.Bitangents[i][:], want[:]) {
+			t.Errorf("%s: vertex %d has bitangent %v, want %v", name, i, m.Bitangents[i], want)
+		}
+	}
+}
+
+func TestComputeTangentsOrthogonal(t *testing.T) {
+	suzanne, err := LoadOBJFile(suzannePath, &OBJOptions{Index: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ComputeTangents(suzanne)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTangentBasis(t, "suzanne", m)
+
+	// UVs that don't vary still give a basis
+	flat := Mesh{
+		Vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		Normals:  []mgl32.Vec3{{1, 0, 0}, {0, 0, 1}, {0, 0, 1}},
+		Uvs:      make([]mgl32.Vec2, 3),
+	}
+	m, err = ComputeTangents(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTangentBasis(t, "constant uvs", m)
+}
+
+// quadMesh returns the unit square facing +Z as two triangles sharing the
+// diagonal from vertex 0 to vertex 2.
+func quadMesh(uvs []mgl32.Vec2) Mesh {
+	up := mgl32.Vec3{0, 0, 1}
+	return Mesh{
+		Indices:  []uint32{0, 1, 2, 0, 2, 3},
+		Vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+		Normals:  []mgl32.Vec3{up, up, up, up},
+		Uvs:      uvs,
+	}
+}
+
+func TestComputeTangentsHandedness(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		uvs     []mgl32.Vec2
+		tangent mgl32.Vec4
+	}{
+		{"regular", []mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}}, mgl32.Vec4{1, 0, 0, 1}},
+		// U grows towards -X while V still grows towards +Y
+		{"mirrored", []mgl32.Vec2{{1, 0}, {0, 0}, {0, 1}, {1, 1}}, mgl32.Vec4{-1, 0, 0, -1}},
+	} {
+		m, err := ComputeTangents(quadMesh(tc.uvs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTangentBasis(t, tc.name, m)
+		for i, tangent := range m.Tangents {
+			if !near(tangent[:], tc.tangent[:]) {
+				t.Errorf("%s: vertex %d has tangent %v, want %v", tc.name, i, tangent, tc.tangent)
+			}
+			if m.Bitangents[i] != (mgl32.Vec3{0, 1, 0}) {
+				t.Errorf("%s: vertex %d has bitangent %v, want +Y", tc.name, i, m.Bitangents[i])
+			}
+		}
+	}
+}
+
+func TestComputeTangentsShared(t *testing.T) {
+	// U follows +X on the first triangle and +Y on the second, whose
+	// mapping is mirrored. The diagonal's vertices average both.
+	m, err := ComputeTangents(quadMesh([]mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {1, 0}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTangentBasis(t, "indexed quad", m)
+	diagonal := float32(math.Sqrt2 / 2)
+	want := []mgl32.Vec4{
+		{diagonal, diagonal, 0, 1},
+		{1, 0, 0, 1},
+		{diagonal, diagonal, 0, 1},
+		{0, 1, 0, -1},
+	}
+	for i, tangent := range m.Tangents {
+		if !near(tangent[:], want[i][:]) {
+			t.Errorf("vertex %d has tangent %v, want %v", i, tangent, want[i])
+		}
+	}
+
+	// Without indices nothing is shared
+	m, err = ComputeTangents(UnindexMesh(quadMesh([]mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {1, 0}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tangent := range m.Tangents {
+		want := mgl32.Vec4{1, 0, 0, 1}
+		if i >= 3 {
+			want = mgl32.Vec4{0, 1, 0, -1}
+		}
+		if !near(tangent[:], want[:]) {
+			t.Errorf("unindexed vertex %d has tangent %v, want %v", i, tangent, want)
+		}
+	}
+}
+
+func TestComputeTangentsMissing(t *testing.T) {
+	quad := quadMesh([]mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}})
+	noUvs, noNormals := quad, quad
+	noUvs.Uvs = nil
+	noNormals.Normals = nil
+	for name, m := range map[string]Mesh{"no uvs": noUvs, "no normals": noNormals} {
+		if _, err := ComputeTangents(m); !errors.Is(err, ErrNoTangentSpace) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrNoTangentSpace)
+		}
+	}
+}
@@ -1,72 +1,90 @@
 package common
 
 import (
-	"encoding/binary"
 	"fmt"
 	"github.com/go-gl/gl/v4.5-core/gl"
-	"log"
 	"os"
-	"strings"
 )
 
+// sRGB formats of the EXT_texture_sRGB extension, which the core profile
+// bindings don't define
 const (
-	FOURCC_DXT1 uint32 = uint32(0x31545844)
-	FOURCC_DXT3 uint32 = uint32(0x33545844)
-	FOURCC_DXT5 uint32 = uint32(0x35545844)
+	glCompressedSRGBAlphaS3TCDXT1 = 35917 // Decimal value for GL_COMPRESSED_SRGB_ALPHA_S3TC_DXT1_EXT
+	glCompressedSRGBAlphaS3TCDXT3 = 35918 // Decimal value for GL_COMPRESSED_SRGB_ALPHA_S3TC_DXT3_EXT
+	glCompressedSRGBAlphaS3TCDXT5 = 35919 // Decimal value for GL_COMPRESSED_SRGB_ALPHA_S3TC_DXT5_EXT
 )
 
-func LoadBMPCustom(imagepath string) uint32 {
-	// Data read from the header of the BMP file
-	header := make([]byte, 54)
-	var dataPos uint32
-	var imageSize uint32
-	var width, height uint32
-	// Actual RGB data
-	var data []byte
-
+// LoadBMPCustom loads a BMP image into a new texture with trilinear
+// filtering.
+func LoadBMPCustom(imagepath string) (uint32, error) {
 	// Open the file
 	f, err := os.Open(imagepath)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
 	defer f.Close()
 
-	// Read the header, i.e. the 54 first bytes
-
-	// If less than 54 bytes are read, problem
-	f.Read(header)
-	// A BMP files always begins with "BM"
-	if string(header[0]) != "B" || string(header[1]) != "M" {
-		fmt.Println("Not a correct BMP file")
-		return 0
-	}
-	// Make sure this is a 24bpp file
-	if binary.LittleEndian.Uint32(header[30:34]) != 0 {
-		fmt.Println("Not a correct BMP file")
+	img, err := DecodeBMP(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", imagepath, err)
 	}
-	if binary.LittleEndian.Uint32(header[28:32]) != 24 {
-		fmt.Println("Not a correct BMP file")
+	return UploadImage(img)
+}
+
+// LoadDDS loads a DDS image with its mipmaps into a new texture, whose
+// target depends on whether it is a cube map, an array or a volume.
+func LoadDDS(imagepath string) (uint32, error) {
+	// try to open the file
+	f, err := os.Open(imagepath)
+	if err != nil {
+		return 0, err
 	}
+	defer f.Close()
 
-	// Read the information about the image
-	dataPos = binary.LittleEndian.Uint32(header[10:14])
-	imageSize = binary.LittleEndian.Uint32(header[34:38])
-	width = binary.LittleEndian.Uint32(header[18:22])
-	height = binary.LittleEndian.Uint32(header[22:26])
+	img, err := DecodeDDS(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", imagepath, err)
+	}
+	return UploadDDSImage(img)
+}
 
-	// Some BMP files are misformatted, guess missing information
-	if imageSize == 0 {
-		imageSize = width * height * 3 // 3 : one byte for each Red, Green and Blue component
+// LoadTGA loads a TGA image into a new texture with trilinear filtering.
+func LoadTGA(imagepath string) (uint32, error) {
+	f, err := os.Open(imagepath)
+	if err != nil {
+		return 0, err
 	}
-	if dataPos == 0 {
-		dataPos = 54 // The BMP header is done that way
+	defer f.Close()
+	img, err := DecodeTGA(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", imagepath, err)
 	}
+	return UploadImage(img)
+}
 
-	// Create a buffer
-	data = make([]byte, imageSize)
+// LoadImage loads a PNG, JPEG or GIF image, or one of any format registered
+// with the image package, into a new texture with trilinear filtering.
+func LoadImage(imagepath string, opts *ImageOptions) (uint32, error) {
+	f, err := os.Open(imagepath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, err := DecodeImage(f, opts)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", imagepath, err)
+	}
+	return UploadImage(img)
+}
 
-	// Read the actual data from the file into the buffer
-	f.Read(data)
+// UploadImage creates a texture holding img, with trilinear filtering and
+// generated mipmaps. It needs a current OpenGL context, and fails if img
+// doesn't have as many pixels as its size needs.
+func UploadImage(img Image) (uint32, error) {
+	if err := img.validate(); err != nil {
+		return 0, err
+	}
+	internalFormat, format, swizzle := glPixelFormat(img.Format, img.SRGB)
 
 	// Create one OpenGL texture
 	var textureId uint32
@@ -74,9 +92,12 @@ func LoadBMPCustom(imagepath string) uint32 {
 
 	// "Bind" the newly created texture : all future texture functions will modify this texture
 	gl.BindTexture(gl.TEXTURE_2D, textureId)
+	// Rows aren't padded to 4 bytes
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
 
 	// Give the image to OpenGL
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, int32(width), int32(height), 0, gl.BGR, gl.UNSIGNED_BYTE, gl.Ptr(&data[0]))
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, int32(img.Width), int32(img.Height), 0, format, gl.UNSIGNED_BYTE, gl.Ptr(&img.Pix[0]))
+	gl.TexParameteriv(gl.TEXTURE_2D, gl.TEXTURE_SWIZZLE_RGBA, &swizzle[0])
 
 	// ... nice trilinear filtering ...
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
@@ -86,63 +107,52 @@ func LoadBMPCustom(imagepath string) uint32 {
 	// ... which requires mipmaps. Generate them automatically.
 	gl.GenerateMipmap(gl.TEXTURE_2D)
 
-	return textureId
+	return textureId, nil
 }
 
-func LoadDDS(imagepath string) uint32 {
-	var header []byte
-	header = make([]byte, 124)
-
-	// try to open the file
-	f, err := os.Open(imagepath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
+// UploadCompressedImage creates a texture holding img and its mipmaps. It
+// needs a current OpenGL context, and fails if img has no mipmap or one of
+// the wrong size.
+func UploadCompressedImage(img CompressedImage) (uint32, error) {
+	return UploadDDSImage(DDSImage{
+		Width:            img.Width,
+		Height:           img.Height,
+		Depth:            1,
+		Layers:           1,
+		Compressed:       true,
+		CompressedFormat: img.Format,
+		Levels:           img.Levels,
+	})
+}
 
-	// verify the type of file
-	var filecode []byte
-	filecode = make([]byte, 4)
-	f.Read(filecode)
-	if strings.Compare(string(filecode), "DDS ") != 0 {
-		return 0
+// UploadDDSImage creates a texture holding img and its mipmaps. Its target
+// is TEXTURE_2D, TEXTURE_CUBE_MAP, TEXTURE_2D_ARRAY, TEXTURE_CUBE_MAP_ARRAY
+// or TEXTURE_3D depending on the shape of img. It needs a current OpenGL
+// context, and fails if img has no mipmap or one of the wrong size.
+func UploadDDSImage(img DDSImage) (uint32, error) {
+	if err := img.validate(); err != nil {
+		return 0, err
 	}
-
-	// get surface desc
-	f.ReadAt(header, 4)
-
-	height := binary.LittleEndian.Uint32(header[8:12])
-	width := binary.LittleEndian.Uint32(header[12:16])
-	linearSize := binary.LittleEndian.Uint32(header[16:20])
-	mipMapCount := binary.LittleEndian.Uint32(header[24:28])
-	fourCC := binary.LittleEndian.Uint32(header[80:84])
-
-	var bufsize uint32
-	// how big is it going to be including all mipmaps?
-	if mipMapCount > 1 {
-		bufsize = linearSize * 2
-	} else {
-		bufsize = linearSize
-	}
-	buffer := make([]byte, bufsize)
-	f.ReadAt(buffer, 128)
-	/*
-		if fourCC == FOURCC_DXT1 {
-			components := 3
-		} else {
-			components := 4
-		}
-	*/
+	var internalFormat int32
 	var format uint32
-	switch fourCC {
-	case FOURCC_DXT1:
-		format = 33777 // Decimal value for GL_COMPRESSED_RGBA_S3TC_DXT1_EXT
-	case FOURCC_DXT3:
-		format = 33778 // Decimal value for GL_COMPRESSED_RGBA_S3TC_DXT3_EXT
-	case FOURCC_DXT5:
-		format = 33779 // Decimal value for GL_COMPRESSED_RGBA_S3TC_DXT5_EXT
-	default:
+	swizzle := [4]int32{gl.RED, gl.GREEN, gl.BLUE, gl.ALPHA}
+	if img.Compressed {
+		format = glCompressedFormat(img.CompressedFormat, img.SRGB)
+	} else {
+		internalFormat, format, swizzle = glPixelFormat(img.PixelFormat, img.SRGB)
+	}
 
+	target := uint32(gl.TEXTURE_2D)
+	layers := img.Layers * img.Faces()
+	switch {
+	case img.Cube && img.Layers > 1:
+		target = gl.TEXTURE_CUBE_MAP_ARRAY
+	case img.Cube:
+		target = gl.TEXTURE_CUBE_MAP
+	case img.Depth > 1:
+		target = gl.TEXTURE_3D
+	case img.Layers > 1:
+		target = gl.TEXTURE_2D_ARRAY
 	}
 
 	// Create one OpenGL texture
@@ -150,34 +160,106 @@ func LoadDDS(imagepath string) uint32 {
 	gl.GenTextures(1, &textureId)
 
 	// "Bind" the newly created texture : all future texture functions will modify this texture
-	gl.BindTexture(gl.TEXTURE_2D, textureId)
+	gl.BindTexture(target, textureId)
 	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
 
-	var blockSize uint32
-	if format == 33777 {
-		blockSize = 8
-	} else {
-		blockSize = 16
+	// load the mipmaps
+	for level, data := range img.Levels {
+		width := int32(max(img.Width>>level, 1))
+		height := int32(max(img.Height>>level, 1))
+		depth := int32(layers)
+		if target == gl.TEXTURE_3D {
+			depth = int32(max(img.Depth>>level, 1))
+		}
+
+		// Cube maps are given one face at a time, the other targets a whole
+		// level
+		targets := []uint32{target}
+		if target == gl.TEXTURE_CUBE_MAP {
+			targets = []uint32{
+				gl.TEXTURE_CUBE_MAP_POSITIVE_X, gl.TEXTURE_CUBE_MAP_NEGATIVE_X,
+				gl.TEXTURE_CUBE_MAP_POSITIVE_Y, gl.TEXTURE_CUBE_MAP_NEGATIVE_Y,
+				gl.TEXTURE_CUBE_MAP_POSITIVE_Z, gl.TEXTURE_CUBE_MAP_NEGATIVE_Z,
+			}
+		}
+		size := len(data) / len(targets)
+		for i, face := range targets {
+			pixels := gl.Ptr(&data[i*size])
+			switch {
+			case target == gl.TEXTURE_2D || target == gl.TEXTURE_CUBE_MAP:
+				if img.Compressed {
+					gl.CompressedTexImage2D(face, int32(level), format, width, height, 0, int32(size), pixels)
+				} else {
+					gl.TexImage2D(face, int32(level), internalFormat, width, height, 0, format, gl.UNSIGNED_BYTE, pixels)
+				}
+			case img.Compressed:
+				gl.CompressedTexImage3D(face, int32(level), format, width, height, depth, 0, int32(size), pixels)
+			default:
+				gl.TexImage3D(face, int32(level), internalFormat, width, height, depth, 0, format, gl.UNSIGNED_BYTE, pixels)
+			}
+		}
 	}
-	offset := 0
+	gl.TexParameteriv(target, gl.TEXTURE_SWIZZLE_RGBA, &swizzle[0])
+	// Files may stop before 1x1, the texture is complete with what they have
+	gl.TexParameteri(target, gl.TEXTURE_MAX_LEVEL, int32(len(img.Levels)-1))
 
-	// load the mipmaps
-	for level := 0; level < int(mipMapCount) && (width > 0 || height > 0); level++ {
-		size := ((width + 3) / 4) * ((height + 3) / 4) * blockSize
-		gl.CompressedTexImage2D(gl.TEXTURE_2D, int32(level), format, int32(width), int32(height), 0, int32(size), gl.Ptr(&buffer[0+offset]))
+	return textureId, nil
+}
 
-		offset += int(size)
-		width /= 2
-		height /= 2
+// glPixelFormat returns the internal format and the pixel format OpenGL
+// knows f as, and how to read RGBA from its channels, greyscale being
+// stored in the red and green channels.
+func glPixelFormat(f PixelFormat, srgb bool) (int32, uint32, [4]int32) {
+	switch f {
+	case PixelGray8:
+		return gl.R8, gl.RED, [4]int32{gl.RED, gl.RED, gl.RED, gl.ONE}
+	case PixelGrayAlpha8:
+		return gl.RG8, gl.RG, [4]int32{gl.RED, gl.RED, gl.RED, gl.GREEN}
+	case PixelRGB8:
+		if srgb {
+			return gl.SRGB8, gl.RGB, [4]int32{gl.RED, gl.GREEN, gl.BLUE, gl.ONE}
+		}
+		return gl.RGB8, gl.RGB, [4]int32{gl.RED, gl.GREEN, gl.BLUE, gl.ONE}
+	}
+	if srgb {
+		return gl.SRGB8_ALPHA8, gl.RGBA, [4]int32{gl.RED, gl.GREEN, gl.BLUE, gl.ALPHA}
+	}
+	return gl.RGBA8, gl.RGBA, [4]int32{gl.RED, gl.GREEN, gl.BLUE, gl.ALPHA}
+}
 
-		// Deal with Non-Power-Of-Two textures. This code is not included in the webpage to reduce clutter.
-		if width < 1 {
-			width = 1
+// glCompressedFormat returns the internal format OpenGL knows f as.
+func glCompressedFormat(f CompressedFormat, srgb bool) uint32 {
+	switch f {
+	case CompressedDXT1:
+		if srgb {
+			return glCompressedSRGBAlphaS3TCDXT1
 		}
-		if height < 1 {
-			height = 1
+		return gl.COMPRESSED_RGBA_S3TC_DXT1_EXT
+	case CompressedDXT3:
+		if srgb {
+			return glCompressedSRGBAlphaS3TCDXT3
 		}
+		return gl.COMPRESSED_RGBA_S3TC_DXT3_EXT
+	case CompressedDXT5:
+		if srgb {
+			return glCompressedSRGBAlphaS3TCDXT5
+		}
+		return gl.COMPRESSED_RGBA_S3TC_DXT5_EXT
+	case CompressedBC4:
+		return gl.COMPRESSED_RED_RGTC1
+	case CompressedBC4Signed:
+		return gl.COMPRESSED_SIGNED_RED_RGTC1
+	case CompressedBC5:
+		return gl.COMPRESSED_RG_RGTC2
+	case CompressedBC5Signed:
+		return gl.COMPRESSED_SIGNED_RG_RGTC2
+	case CompressedBC6H:
+		return gl.COMPRESSED_RGB_BPTC_UNSIGNED_FLOAT
+	case CompressedBC6HSigned:
+		return gl.COMPRESSED_RGB_BPTC_SIGNED_FLOAT
 	}
-
-	return textureId
+	if srgb {
+		return gl.COMPRESSED_SRGB_ALPHA_BPTC_UNORM
+	}
+	return gl.COMPRESSED_RGBA_BPTC_UNORM
 }
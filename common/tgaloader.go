@@ -0,0 +1,242 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrTGAFormat      = errors.New("malformed TGA")
+	ErrTGAUnsupported = errors.New("unsupported TGA")
+)
+
+// TGA image types, plus 8 for the RLE compressed variants
+const (
+	tgaColorMapped = 1
+	tgaTrueColor   = 2
+	tgaGray        = 3
+	tgaRLE         = 8
+)
+
+const tgaHeaderSize = 18
+
+// DecodeTGA reads an uncompressed or RLE compressed TGA image from r, whether
+// true color, greyscale or color mapped. True color pixels may use 15, 16, 24
+// or 32 bits, greyscale ones 8 or 16 with alpha, as may color map entries.
+// Rows are reordered for OpenGL whichever corner the file starts from.
+func DecodeTGA(r io.Reader) (Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Image{}, err
+	}
+	if len(data) < tgaHeaderSize {
+		return Image{}, fmt.Errorf("%w: truncated header", ErrTGAFormat)
+	}
+	idLength := int(data[0])
+	colorMapType := data[1]
+	imageType := int(data[2])
+	colorMapFirst := int(binary.LittleEndian.Uint16(data[3:5]))
+	colorMapLength := int(binary.LittleEndian.Uint16(data[5:7]))
+	colorMapDepth := int(data[7])
+	width := int(binary.LittleEndian.Uint16(data[12:14]))
+	height := int(binary.LittleEndian.Uint16(data[14:16]))
+	depth := int(data[16])
+	descriptor := data[17]
+	alphaBits := int(descriptor & 0x0f)
+	rightToLeft := descriptor&0x10 != 0
+	topToBottom := descriptor&0x20 != 0
+
+	if width == 0 || height == 0 {
+		return Image{}, fmt.Errorf("%w: empty image", ErrTGAFormat)
+	}
+	data = data[tgaHeaderSize:]
+	if len(data) < idLength {
+		return Image{}, fmt.Errorf("%w: truncated image ID", ErrTGAFormat)
+	}
+	data = data[idLength:]
+
+	// The color map comes first, even in images that don't use it
+	var colorMap []byte
+	if colorMapType == 1 {
+		size := colorMapLength * ((colorMapDepth + 7) / 8)
+		if len(data) < size {
+			return Image{}, fmt.Errorf("%w: truncated color map", ErrTGAFormat)
+		}
+		colorMap, data = data[:size], data[size:]
+	} else if colorMapType != 0 {
+		return Image{}, fmt.Errorf("%w: color map type %d", ErrTGAUnsupported, colorMapType)
+	}
+
+	// How to turn a pixel of the file into one of the image
+	img := Image{Width: width, Height: height}
+	var convert func(dst, src []byte)
+	switch imageType &^ tgaRLE {
+	case tgaTrueColor:
+		img.Format, convert, err = tgaColorConverter(depth, alphaBits)
+	case tgaGray:
+		switch depth {
+		case 8:
+			img.Format = PixelGray8
+			convert = func(dst, src []byte) { dst[0] = src[0] }
+		case 16:
+			img.Format = PixelGrayAlpha8
+			convert = func(dst, src []byte) { dst[0], dst[1] = src[0], src[1] }
+		default:
+			err = fmt.Errorf("%w: %d bit greyscale", ErrTGAUnsupported, depth)
+		}
+	case tgaColorMapped:
+		if colorMap == nil {
+			return Image{}, fmt.Errorf("%w: color mapped image without color map", ErrTGAFormat)
+		}
+		if depth != 8 && depth != 16 {
+			return Image{}, fmt.Errorf("%w: %d bit color map index", ErrTGAUnsupported, depth)
+		}
+		// Convert the color map, and pixels become indices into it
+		var convertEntry func(dst, src []byte)
+		if img.Format, convertEntry, err = tgaColorConverter(colorMapDepth, alphaBits); err != nil {
+			return Image{}, err
+		}
+		entrySize := (colorMapDepth + 7) / 8
+		outSize := img.Format.BytesPerPixel()
+		palette := make([]byte, colorMapLength*outSize)
+		for i := 0; i < colorMapLength; i++ {
+			convertEntry(palette[i*outSize:], colorMap[i*entrySize:])
+		}
+		convert = func(dst, src []byte) {
+			index := int(src[0])
+			if depth == 16 {
+				index = int(binary.LittleEndian.Uint16(src))
+			}
+			index -= colorMapFirst
+			if index < 0 || index >= colorMapLength {
+				err = fmt.Errorf("%w: color map index %d out of range", ErrTGAFormat, index+colorMapFirst)
+				return
+			}
+			copy(dst[:outSize], palette[index*outSize:])
+		}
+	default:
+		err = fmt.Errorf("%w: image type %d", ErrTGAUnsupported, imageType)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+
+	pixelSize := (depth + 7) / 8
+	var pixels []byte
+	if imageType&tgaRLE != 0 {
+		if pixels, err = decodeTGARLE(data, width*height, pixelSize); err != nil {
+			return Image{}, err
+		}
+	} else {
+		if len(data) < width*height*pixelSize {
+			return Image{}, fmt.Errorf("%w: truncated pixel data", ErrTGAFormat)
+		}
+		pixels = data[:width*height*pixelSize]
+	}
+
+	outSize := img.Format.BytesPerPixel()
+	img.Pix = make([]byte, width*height*outSize)
+	for y := 0; y < height; y++ {
+		row := y
+		if topToBottom {
+			row = height - 1 - y
+		}
+		for x := 0; x < width; x++ {
+			column := x
+			if rightToLeft {
+				column = width - 1 - x
+			}
+			src := pixels[(y*width+x)*pixelSize:]
+			convert(img.Pix[(row*width+column)*outSize:], src)
+		}
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	return img, nil
+}
+
+// tgaColorConverter returns the format and the conversion of true color TGA
+// pixels of depth bits, which are stored in BGR order. alphaBits is the
+// number of attribute bits of the image descriptor.
+func tgaColorConverter(depth, alphaBits int) (PixelFormat, func(dst, src []byte), error) {
+	switch depth {
+	case 15, 16:
+		// 5 bits per channel, and an alpha bit when attribute bits say so
+		withAlpha := depth == 16 && alphaBits == 1
+		format := PixelRGB8
+		if withAlpha {
+			format = PixelRGBA8
+		}
+		return format, func(dst, src []byte) {
+			v := binary.LittleEndian.Uint16(src)
+			dst[0] = expand5(v >> 10)
+			dst[1] = expand5(v >> 5)
+			dst[2] = expand5(v)
+			if withAlpha {
+				dst[3] = byte(v>>15) * 0xff
+			}
+		}, nil
+	case 24:
+		return PixelRGB8, func(dst, src []byte) {
+			dst[0], dst[1], dst[2] = src[2], src[1], src[0]
+		}, nil
+	case 32:
+		// Without attribute bits the 4th byte is padding, often left 0
+		if alphaBits == 0 {
+			return PixelRGB8, func(dst, src []byte) {
+				dst[0], dst[1], dst[2] = src[2], src[1], src[0]
+			}, nil
+		}
+		return PixelRGBA8, func(dst, src []byte) {
+			dst[0], dst[1], dst[2], dst[3] = src[2], src[1], src[0], src[3]
+		}, nil
+	}
+	return 0, nil, fmt.Errorf("%w: %d bit color", ErrTGAUnsupported, depth)
+}
+
+// expand5 scales the low 5 bits of v to a byte.
+func expand5(v uint16) byte {
+	v &= 0x1f
+	return byte(v<<3 | v>>2)
+}
+
+// decodeTGARLE expands count pixels of pixelSize bytes. Each packet starts
+// with a byte whose high bit tells a run of one repeated pixel from raw
+// pixels, and whose low bits are the number of pixels minus one. Packets
+// may cross rows.
+func decodeTGARLE(data []byte, count, pixelSize int) ([]byte, error) {
+	// Packets cover at most 128 pixels, so data too short for that many
+	// can't be expanded, and nothing is allocated for it
+	if len(data)/(1+pixelSize) < (count+127)/128 {
+		return nil, fmt.Errorf("%w: truncated RLE data", ErrTGAFormat)
+	}
+	pixels := make([]byte, 0, count*pixelSize)
+	for len(pixels) < count*pixelSize {
+		if len(data) == 0 {
+			return nil, fmt.Errorf("%w: truncated RLE data", ErrTGAFormat)
+		}
+		packet := data[0]
+		data = data[1:]
+		// Some writers let the last packet run past the end of the image
+		n := min(int(packet&0x7f)+1, count-len(pixels)/pixelSize)
+		if packet&0x80 != 0 {
+			if len(data) < pixelSize {
+				return nil, fmt.Errorf("%w: truncated RLE data", ErrTGAFormat)
+			}
+			for i := 0; i < n; i++ {
+				pixels = append(pixels, data[:pixelSize]...)
+			}
+			data = data[pixelSize:]
+		} else {
+			if len(data) < n*pixelSize {
+				return nil, fmt.Errorf("%w: truncated RLE data", ErrTGAFormat)
+			}
+			pixels = append(pixels, data[:n*pixelSize]...)
+			data = data[n*pixelSize:]
+		}
+	}
+	return pixels, nil
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// tgaHeader returns the header of an image without color map.
+func tgaHeader(imageType, width, height, depth int, descriptor byte) []byte {
+	header := make([]byte, tgaHeaderSize)
+	header[2] = byte(imageType)
+	binary.LittleEndian.PutUint16(header[12:], uint16(width))
+	binary.LittleEndian.PutUint16(header[14:], uint16(height))
+	header[16] = byte(depth)
+	header[17] = descriptor
+	return header
+}
+
+func TestDecodeTGA32(t *testing.T) {
+	// One BGRA pixel, whose 4th byte only is alpha with 8 attribute bits
+	pixel := []byte{0x10, 0x20, 0x30, 0x00}
+	for _, tc := range []struct {
+		alphaBits byte
+		format    PixelFormat
+		pix       []byte
+	}{
+		{0, PixelRGB8, []byte{0x30, 0x20, 0x10}},
+		{8, PixelRGBA8, []byte{0x30, 0x20, 0x10, 0x00}},
+	} {
+		data := append(tgaHeader(tgaTrueColor, 1, 1, 32, tc.alphaBits), pixel...)
+		img, err := DecodeTGA(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Format != tc.format || !bytes.Equal(img.Pix, tc.pix) {
+			t.Errorf("%d alpha bits: got format %d and %v, want %d and %v", tc.alphaBits, img.Format, img.Pix, tc.format, tc.pix)
+		}
+	}
+}
+
+func TestDecodeTGAAsset(t *testing.T) {
+	f, err := os.Open("../tutorial05/uvtemplate.tga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := DecodeTGA(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 512 || img.Height != 512 || img.Format != PixelRGB8 || len(img.Pix) != 512*512*3 {
+		t.Fatalf("got %dx%d format %d with %d bytes", img.Width, img.Height, img.Format, len(img.Pix))
+	}
+	// The file starts from the bottom row, and stores pixels as BGR
+	for _, p := range []struct {
+		x, y int
+		rgb  []byte
+	}{
+		{0, 0, []byte{255, 255, 255}},
+		{511, 0, []byte{255, 255, 255}},
+		{0, 511, []byte{0, 0, 0}},
+		{511, 511, []byte{0, 0, 0}},
+		{300, 200, []byte{255, 255, 255}},
+		{401, 388, []byte{255, 0, 4}},
+	} {
+		if got := pixelAt(img, p.x, p.y); !bytes.Equal(got, p.rgb) {
+			t.Errorf("pixel %d, %d is %v, want %v", p.x, p.y, got, p.rgb)
+		}
+	}
+}
+
+// TestDecodeTGARLETruncated checks that RLE data too short for the
+// dimensions of the header is rejected before the pixels are allocated.
+func TestDecodeTGARLETruncated(t *testing.T) {
+	data := append(tgaHeader(tgaTrueColor|tgaRLE, 65535, 65535, 32, 8), 0xff, 1, 2, 3, 4)
+	if _, err := DecodeTGA(bytes.NewReader(data)); !errors.Is(err, ErrTGAFormat) {
+		t.Errorf("got %v, want %v", err, ErrTGAFormat)
+	}
+
+	// 130 pixels take two packets, a run of 128 and 2 raw pixels
+	data = append(tgaHeader(tgaGray|tgaRLE, 130, 1, 8, 0), 0xff, 7, 0x01, 8, 9)
+	img, err := DecodeTGA(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(bytes.Repeat([]byte{7}, 128), 8, 9); !bytes.Equal(img.Pix, want) {
+		t.Errorf("pixels %v, want %v", img.Pix, want)
+	}
+}
@@ -0,0 +1,165 @@
+package common
+
+import (
+	"strconv"
+)
+
+// Allocation free helpers for the text mesh formats. They work on the bytes
+// returned by bufio.Scanner.Bytes, which are only valid until the next Scan.
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// splitFields is bytes.Fields for ASCII whitespace, reusing dst.
+func splitFields(dst [][]byte, line []byte) [][]byte {
+	dst = dst[:0]
+	for i := 0; i < len(line); {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		start := i
+		for i < len(line) && !isSpace(line[i]) {
+			i++
+		}
+		if i > start {
+			dst = append(dst, line[start:i])
+		}
+	}
+	return dst
+}
+
+// restOfLine returns what follows the first n fields of line, as split by
+// splitFields, without the whitespace around it. Names that may contain
+// spaces are read with it rather than rebuilt from their fields.
+func restOfLine(line string, n int) string {
+	i := 0
+	for ; n > 0; n-- {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		for i < len(line) && !isSpace(line[i]) {
+			i++
+		}
+	}
+	for i < len(line) && isSpace(line[i]) {
+		i++
+	}
+	end := len(line)
+	for end > i && isSpace(line[end-1]) {
+		end--
+	}
+	return line[i:end]
+}
+
+var float32pow10 = [...]float32{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10}
+
+// parseFloat parses a decimal number. Numbers that fit in a float32 mantissa
+// with a small exponent, which is most of what exporters write, are converted
+// exactly with a single multiplication or division. Anything else goes
+// through strconv, so the result is always the same as strconv.ParseFloat.
+func parseFloat(b []byte) (float32, bool) {
+	i := 0
+	negative := false
+	if i < len(b) && (b[i] == '+' || b[i] == '-') {
+		negative = b[i] == '-'
+		i++
+	}
+
+	var mantissa uint64
+	exp := 0
+	digits := 0
+	sawDigit, sawDot := false, false
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c == '.' && !sawDot {
+			sawDot = true
+			continue
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+		sawDigit = true
+		if mantissa == 0 && c == '0' {
+			// Leading zeros don't count towards the precision
+			if sawDot {
+				exp--
+			}
+			continue
+		}
+		digits++
+		if digits > 18 {
+			return parseFloatSlow(b)
+		}
+		mantissa = mantissa*10 + uint64(c-'0')
+		if sawDot {
+			exp--
+		}
+	}
+	if !sawDigit {
+		return parseFloatSlow(b)
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		e, ok := parseInt(b[i+1:])
+		if !ok || e > 1000 || e < -1000 {
+			return parseFloatSlow(b)
+		}
+		exp += e
+		i = len(b)
+	}
+	if i != len(b) {
+		return parseFloatSlow(b)
+	}
+
+	var f float32
+	if mantissa != 0 {
+		for mantissa%10 == 0 {
+			mantissa /= 10
+			exp++
+		}
+		if mantissa >= 1<<24 || exp > 10 || exp < -10 {
+			return parseFloatSlow(b)
+		}
+		f = float32(mantissa)
+		if exp < 0 {
+			f /= float32pow10[-exp]
+		} else {
+			f *= float32pow10[exp]
+		}
+	}
+	if negative {
+		f = -f
+	}
+	return f, true
+}
+
+func parseFloatSlow(b []byte) (float32, bool) {
+	f, err := strconv.ParseFloat(string(b), 32)
+	return float32(f), err == nil
+}
+
+// parseInt parses a signed decimal integer.
+func parseInt(b []byte) (int, bool) {
+	i := 0
+	negative := false
+	if i < len(b) && (b[i] == '+' || b[i] == '-') {
+		negative = b[i] == '-'
+		i++
+	}
+	if i == len(b) || len(b)-i > 18 {
+		return 0, false
+	}
+
+	n := 0
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	if negative {
+		n = -n
+	}
+	return n, true
+}
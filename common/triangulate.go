@@ -0,0 +1,159 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Triangulate splits a planar polygon into triangles and returns them as
+// indices into polygon, three per triangle, keeping the polygon's winding.
+// Convex polygons are fanned from their first vertex, concave ones are split
+// by ear clipping.
+func Triangulate(polygon []mgl32.Vec3) []int {
+	var t triangulator
+	return t.triangulate(polygon)
+}
+
+// triangulator keeps the buffers used by Triangulate so loaders can reuse
+// them from one face to the next.
+type triangulator struct {
+	points    []mgl32.Vec2
+	remaining []int
+	triangles []int
+}
+
+// triangulate is Triangulate, returning a slice that is only valid until the
+// next call.
+func (t *triangulator) triangulate(polygon []mgl32.Vec3) []int {
+	n := len(polygon)
+	t.triangles = t.triangles[:0]
+	if n < 3 {
+		return t.triangles
+	}
+	if n == 3 {
+		t.triangles = append(t.triangles, 0, 1, 2)
+		return t.triangles
+	}
+
+	// Project the polygon onto the plane of its dominant axis
+	normal := newellNormal(polygon)
+	if normal.Len() == 0 {
+		return t.fan(n)
+	}
+	t.points = projectPolygon(t.points[:0], polygon, normal)
+
+	// The projection keeps a counter-clockwise winding when seen along the
+	// normal, so convex corners have a positive cross product.
+	if isConvex(t.points) {
+		return t.fan(n)
+	}
+	t.triangles = t.earClip()
+	return t.triangles
+}
+
+// fan triangulates a convex polygon of n vertices around its first vertex.
+func (t *triangulator) fan(n int) []int {
+	for i := 1; i < n-1; i++ {
+		t.triangles = append(t.triangles, 0, i, i+1)
+	}
+	return t.triangles
+}
+
+// newellNormal returns the (unnormalised) normal of a possibly non-planar polygon.
+func newellNormal(polygon []mgl32.Vec3) mgl32.Vec3 {
+	var normal mgl32.Vec3
+	for i, current := range polygon {
+		next := polygon[(i+1)%len(polygon)]
+		normal[0] += (current[1] - next[1]) * (current[2] + next[2])
+		normal[1] += (current[2] - next[2]) * (current[0] + next[0])
+		normal[2] += (current[0] - next[0]) * (current[1] + next[1])
+	}
+	return normal
+}
+
+// projectPolygon drops the axis the normal points the most along, swapping the
+// two others if needed so the winding stays counter-clockwise.
+func projectPolygon(points []mgl32.Vec2, polygon []mgl32.Vec3, normal mgl32.Vec3) []mgl32.Vec2 {
+	x, y := 1, 2
+	axis := 0
+	if math.Abs(float64(normal[1])) > math.Abs(float64(normal[axis])) {
+		axis, x, y = 1, 2, 0
+	}
+	if math.Abs(float64(normal[2])) > math.Abs(float64(normal[axis])) {
+		axis, x, y = 2, 0, 1
+	}
+	if normal[axis] < 0 {
+		x, y = y, x
+	}
+
+	for _, p := range polygon {
+		points = append(points, mgl32.Vec2{p[x], p[y]})
+	}
+	return points
+}
+
+func cross2(o, a, b mgl32.Vec2) float32 {
+	return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+}
+
+func isConvex(points []mgl32.Vec2) bool {
+	n := len(points)
+	for i := range points {
+		if cross2(points[(i+n-1)%n], points[i], points[(i+1)%n]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// earClip triangulates a simple counter-clockwise polygon by repeatedly cutting
+// off a convex corner that contains no other vertex.
+func (t *triangulator) earClip() []int {
+	points := t.points
+	remaining := t.remaining[:0]
+	for i := range points {
+		remaining = append(remaining, i)
+	}
+	t.remaining = remaining
+	triangles := t.triangles
+
+	for len(remaining) > 3 {
+		n := len(remaining)
+		found := false
+		for i := 0; i < n; i++ {
+			prev, current, next := remaining[(i+n-1)%n], remaining[i], remaining[(i+1)%n]
+			if !isEar(points, remaining, prev, current, next) {
+				continue
+			}
+			triangles = append(triangles, prev, current, next)
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			found = true
+			break
+		}
+		if !found {
+			// Self-intersecting or degenerate : fan whatever is left
+			for i := 1; i < len(remaining)-1; i++ {
+				triangles = append(triangles, remaining[0], remaining[i], remaining[i+1])
+			}
+			return triangles
+		}
+	}
+	return append(triangles, remaining[0], remaining[1], remaining[2])
+}
+
+func isEar(points []mgl32.Vec2, remaining []int, prev, current, next int) bool {
+	a, b, c := points[prev], points[current], points[next]
+	if cross2(a, b, c) <= 0 {
+		return false
+	}
+	for _, i := range remaining {
+		if i == prev || i == current || i == next {
+			continue
+		}
+		p := points[i]
+		if cross2(a, b, p) >= 0 && cross2(b, c, p) >= 0 && cross2(c, a, p) >= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTriangulate(t *testing.T) {
+	dart := []mgl32.Vec3{{0, 0, 0}, {4, 0, 0}, {4, 4, 0}, {2, 1, 0}, {0, 4, 0}}
+	reversed := make([]mgl32.Vec3, len(dart))
+	upright := make([]mgl32.Vec3, len(dart))
+	for i, p := range dart {
+		reversed[len(dart)-1-i] = p
+		upright[i] = mgl32.Vec3{p.X(), 0, p.Y()}
+	}
+	for _, tc := range []struct {
+		name    string
+		polygon []mgl32.Vec3
+		area    float32
+	}{
+		{"triangle", dart[:3], 8},
+		{"quad", []mgl32.Vec3{{0, 0, 0}, {3, 0, 0}, {2, 2, 0}, {0, 1, 0}}, 4},
+		{"dart", dart, 10},
+		{"clockwise dart", reversed, 10},
+		{"upright dart", upright, 10},
+		{"L", []mgl32.Vec3{{0, 0, 0}, {2, 0, 0}, {2, 1, 0}, {1, 1, 0}, {1, 2, 0}, {0, 2, 0}}, 3},
+		// Reflex corners next to each other
+		{"comb", []mgl32.Vec3{{0, 0, 0}, {5, 0, 0}, {5, 3, 0}, {4, 3, 0}, {4, 1, 0}, {3, 1, 0}, {3, 3, 0}, {2, 3, 0}, {2, 1, 0}, {1, 1, 0}, {1, 3, 0}, {0, 3, 0}}, 11},
+	} {
+		triangles := Triangulate(tc.polygon)
+		if len(triangles) != 3*(len(tc.polygon)-2) {
+			t.Errorf("%s: %d indices, want %d", tc.name, len(triangles), 3*(len(tc.polygon)-2))
+			continue
+		}
+		// Every triangle keeps the polygon's winding, and together they
+		// cover it once
+		normal := newellNormal(tc.polygon)
+		var area float32
+		for i := 0; i < len(triangles); i += 3 {
+			p0, p1, p2 := tc.polygon[triangles[i]], tc.polygon[triangles[i+1]], tc.polygon[triangles[i+2]]
+			n := p1.Sub(p0).Cross(p2.Sub(p0))
+			if n.Dot(normal) <= 0 {
+				t.Errorf("%s: triangle %v %v %v faces %v", tc.name, p0, p1, p2, n)
+			}
+			area += n.Len() / 2
+		}
+		if math.Abs(float64(area-tc.area)) > 1e-4 {
+			t.Errorf("%s: area %v, want %v", tc.name, area, tc.area)
+		}
+	}
+
+	// Convex polygons are fanned from their first vertex
+	square := []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	if got, want := Triangulate(square), []int{0, 1, 2, 0, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fan: got %v, want %v", got, want)
+	}
+	if got := Triangulate(dart[:2]); len(got) != 0 {
+		t.Errorf("two vertices: got %v", got)
+	}
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// VFlip selects how V texture coordinates are converted to match the origin
+// of a texture loader.
+type VFlip int
+
+const (
+	// VFlipNone keeps V as written in the file, for textures stored bottom
+	// row first like BMP and TGA.
+	VFlipNone VFlip = iota
+	// VFlipNegate uses -V, for textures stored top row first like DDS. It
+	// relies on the sampler repeating, which the tutorials' textures do.
+	VFlipNegate
+	// VFlipOneMinus uses 1-V, like VFlipNegate but keeping V in [0, 1] for
+	// samplers that clamp.
+	VFlipOneMinus
+)
+
+// Apply returns uv converted according to f.
+func (f VFlip) Apply(uv mgl32.Vec2) mgl32.Vec2 {
+	switch f {
+	case VFlipNegate:
+		uv[1] = -uv[1]
+	case VFlipOneMinus:
+		uv[1] = 1 - uv[1]
+	}
+	return uv
+}
+
+// FlipUVs returns a copy of m with every V coordinate converted according to
+// f, so a mesh loaded for one texture loader can be drawn with another. Both
+// conversions are their own inverse. Tangents are dropped since flipping
+// changes their handedness.
+func FlipUVs(m Mesh, f VFlip) Mesh {
+	if m.Uvs == nil || f == VFlipNone {
+		return m
+	}
+
+	out := m
+	out.Uvs = make([]mgl32.Vec2, len(m.Uvs))
+	for i, uv := range m.Uvs {
+		out.Uvs[i] = f.Apply(uv)
+	}
+	out.Tangents = nil
+	out.Bitangents = nil
+	return out
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlipUVs(t *testing.T) {
+	uvs := []mgl32.Vec2{{0, 0}, {1, 0.25}, {1, 1}, {0, 0.75}}
+	quad, err := ComputeTangents(quadMesh(uvs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		flip VFlip
+		uvs  []mgl32.Vec2
+	}{
+		{VFlipNone, uvs},
+		{VFlipOneMinus, []mgl32.Vec2{{0, 1}, {1, 0.75}, {1, 0}, {0, 0.25}}},
+		{VFlipNegate, []mgl32.Vec2{{0, 0}, {1, -0.25}, {1, -1}, {0, -0.75}}},
+	} {
+		m := FlipUVs(quad, tc.flip)
+		if !reflect.DeepEqual(m.Uvs, tc.uvs) {
+			t.Errorf("%d: got uvs %v, want %v", tc.flip, m.Uvs, tc.uvs)
+		}
+		// Only a flip changes the handedness of the tangents
+		if flipped := tc.flip != VFlipNone; flipped != (m.Tangents == nil) || flipped != (m.Bitangents == nil) {
+			t.Errorf("%d: got %d tangents and %d bitangents", tc.flip, len(m.Tangents), len(m.Bitangents))
+		}
+		if !reflect.DeepEqual(m.Vertices, quad.Vertices) || !reflect.DeepEqual(m.Indices, quad.Indices) {
+			t.Errorf("%d: vertices or indices changed", tc.flip)
+		}
+		if !reflect.DeepEqual(quad.Uvs, uvs) {
+			t.Fatalf("%d: source uvs changed to %v", tc.flip, quad.Uvs)
+		}
+		// Flipping again gives the source back
+		if back := FlipUVs(m, tc.flip); !reflect.DeepEqual(back.Uvs, uvs) {
+			t.Errorf("%d: flipped back to %v", tc.flip, back.Uvs)
+		}
+
+		// Loading with the flip gives the same coordinates
+		loaded, err := ReadOBJ(strings.NewReader(objTriangle+"f 1/1 2/2 3/3"), "flip.obj", &OBJOptions{FlipV: tc.flip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := FlipUVs(Mesh{Uvs: []mgl32.Vec2{{0, 0}, {1, 0}, {0, 1}}}, tc.flip).Uvs; !reflect.DeepEqual(loaded.Uvs, want) {
+			t.Errorf("%d: loaded uvs %v, want %v", tc.flip, loaded.Uvs, want)
+		}
+	}
+
+	// Meshes without texture coordinates keep their tangents
+	noUvs := quad
+	noUvs.Uvs = nil
+	if m := FlipUVs(noUvs, VFlipOneMinus); m.Tangents == nil {
+		t.Error("tangents dropped from a mesh without uvs")
+	}
+}
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+type packedVertex struct {
+	position  mgl32.Vec3
+	uv        mgl32.Vec2
+	normal    mgl32.Vec3
+	color     mgl32.Vec4
+	tangent   mgl32.Vec4
+	bitangent mgl32.Vec3
+}
+
+// packVertex gathers every attribute of vertex i, zero for absent ones.
+func (m *Mesh) packVertex(i uint32) packedVertex {
+	packed := packedVertex{position: m.Vertices[i]}
+	if m.Uvs != nil {
+		packed.uv = m.Uvs[i]
+	}
+	if m.Normals != nil {
+		packed.normal = m.Normals[i]
+	}
+	if m.Colors != nil {
+		packed.color = m.Colors[i]
+	}
+	if m.Tangents != nil {
+		packed.tangent = m.Tangents[i]
+		packed.bitangent = m.Bitangents[i]
+	}
+	return packed
+}
+
+// appendVertex adds vertex i of src to m, with the attributes src has.
+func (m *Mesh) appendVertex(src *Mesh, i uint32) {
+	m.Vertices = append(m.Vertices, src.Vertices[i])
+	if src.Uvs != nil {
+		m.Uvs = append(m.Uvs, src.Uvs[i])
+	}
+	if src.Normals != nil {
+		m.Normals = append(m.Normals, src.Normals[i])
+	}
+	if src.Colors != nil {
+		m.Colors = append(m.Colors, src.Colors[i])
+	}
+	if src.Tangents != nil {
+		m.Tangents = append(m.Tangents, src.Tangents[i])
+		m.Bitangents = append(m.Bitangents, src.Bitangents[i])
+	}
+}
+
+// clearVertices empties every vertex attribute of m, keeping the rest.
+func (m *Mesh) clearVertices() {
+	m.Indices = nil
+	m.Vertices = nil
+	m.Uvs = nil
+	m.Normals = nil
+	m.Colors = nil
+	m.Tangents = nil
+	m.Bitangents = nil
+}
+
+// IndexMesh returns a copy of m where identical vertices, comparing every
+// attribute, are stored once and triangles refer to them through Indices,
+// ready for gl.DrawElements. The triangle order is kept, so ranges into the
+// original vertex list stay valid as ranges into Indices.
+func IndexMesh(m Mesh) Mesh {
+	out := m
+	out.clearVertices()
+	out.Indices = make([]uint32, 0, 3*m.TriangleCount())
+
+	vertexToOutIndex := make(map[packedVertex]uint32)
+	for t := 0; t < m.TriangleCount(); t++ {
+		a, b, c := m.Triangle(t)
+		for _, i := range [3]uint32{a, b, c} {
+			packed := m.packVertex(i)
+
+			// Try to find a similar vertex in out
+			index, found := vertexToOutIndex[packed]
+			if !found {
+				// If not, it needs to be added in the output data
+				index = uint32(len(out.Vertices))
+				out.appendVertex(&m, i)
+				vertexToOutIndex[packed] = index
+			}
+			out.Indices = append(out.Indices, index)
+		}
+	}
+	return out
+}
+
+// UnindexMesh returns a copy of m where every triangle has its own three
+// vertices, as gl.DrawArrays expects. Meshes that aren't indexed are
+// returned as they are.
+func UnindexMesh(m Mesh) Mesh {
+	if m.Indices == nil {
+		return m
+	}
+
+	out := m
+	out.clearVertices()
+	for _, index := range m.Indices {
+		out.appendVertex(&m, index)
+	}
+	return out
+}
+
+// Indices16 returns the indices of m as uint16, for use with
+// gl.UNSIGNED_SHORT. It reports false if m isn't indexed or has too many
+// vertices for that.
+func (m *Mesh) Indices16() ([]uint16, bool) {
+	if m.Indices == nil || len(m.Vertices) > math.MaxUint16+1 {
+		return nil, false
+	}
+	indices := make([]uint16, len(m.Indices))
+	for i, index := range m.Indices {
+		indices[i] = uint16(index)
+	}
+	return indices, true
+}
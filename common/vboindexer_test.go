@@ -0,0 +1,29 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"reflect"
+	"testing"
+)
+
+func TestIndices16(t *testing.T) {
+	quad := quadMesh(nil)
+	full := Mesh{Vertices: make([]mgl32.Vec3, 1<<16), Indices: []uint32{0, 1, 1<<16 - 1}}
+	tooMany := Mesh{Vertices: make([]mgl32.Vec3, 1<<16+1), Indices: []uint32{0, 1, 2}}
+	for _, tc := range []struct {
+		name    string
+		m       Mesh
+		indices []uint16
+		ok      bool
+	}{
+		{"quad", quad, []uint16{0, 1, 2, 0, 2, 3}, true},
+		{"65536 vertices", full, []uint16{0, 1, 65535}, true},
+		{"65537 vertices", tooMany, nil, false},
+		{"not indexed", UnindexMesh(quad), nil, false},
+	} {
+		indices, ok := tc.m.Indices16()
+		if ok != tc.ok || !reflect.DeepEqual(indices, tc.indices) {
+			t.Errorf("%s: got %v, %v, want %v, %v", tc.name, indices, ok, tc.indices, tc.ok)
+		}
+	}
+}
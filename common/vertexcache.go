@@ -0,0 +1,413 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"sort"
+)
+
+// defaultVertexCacheSize is the number of vertices the post-transform cache
+// is assumed to hold when VertexCacheOptions doesn't say.
+const defaultVertexCacheSize = 32
+
+// VertexCacheOptions controls OptimizeVertexCache.
+type VertexCacheOptions struct {
+	// CacheSize is the number of vertices the GPU keeps after transforming
+	// them. 0 means 32, which suits most hardware.
+	CacheSize int
+	// OverdrawThreshold, when above 1, also sorts parts of the mesh so that
+	// those facing outwards are drawn first and hide the ones behind them,
+	// as long as the ACMR doesn't grow by more than this factor. 1.05 is a
+	// good start. 0 optimizes for the vertex cache only.
+	OverdrawThreshold float32
+}
+
+// ACMR returns the average cache miss ratio of m, the number of vertices a
+// GPU with a FIFO cache of cacheSize vertices transforms per triangle. It
+// ranges from 3, when no vertex is reused, down to about 0.5 for large
+// regular grids. A cacheSize of 0 means 32.
+func ACMR(m Mesh, cacheSize int) float32 {
+	triangleCount := m.TriangleCount()
+	if triangleCount == 0 {
+		return 0
+	}
+	cache := newFIFOCache(len(m.Vertices), cacheSize)
+	misses := 0
+	for t := 0; t < triangleCount; t++ {
+		a, b, c := m.Triangle(t)
+		misses += cache.use(a, b, c)
+	}
+	return float32(misses) / float32(triangleCount)
+}
+
+// OptimizeVertexCache returns a copy of m whose triangles are reordered so
+// that vertices are reused while they are still in the GPU's post-transform
+// cache, using Tom Forsyth's linear-speed algorithm. Compare ACMR before and
+// after to measure the gain. Triangles stay within their sub-mesh, and
+// smoothing groups follow them. Meshes that aren't indexed are indexed first.
+// Run OptimizeVertexFetch afterwards to reorder the vertices to match.
+func OptimizeVertexCache(m Mesh, opts VertexCacheOptions) Mesh {
+	return optimizeVertexCache(m, m.SubMeshes, nil, opts)
+}
+
+// OptimizeModelVertexCache is OptimizeVertexCache for a Model, whose
+// triangles also stay within their object and group.
+func OptimizeModelVertexCache(m Model, opts VertexCacheOptions) Model {
+	out := m
+	out.Mesh = optimizeVertexCache(m.Mesh, m.SubMeshes, m.Objects, opts)
+	return out
+}
+
+// OptimizeVertexFetch returns a copy of m whose vertices are stored in the
+// order the triangles first use them, so that the GPU reads vertex data
+// mostly sequentially. Vertices no triangle uses are dropped. Meshes that
+// aren't indexed are returned as they are.
+func OptimizeVertexFetch(m Mesh) Mesh {
+	if m.Indices == nil {
+		return m
+	}
+
+	out := m
+	out.clearVertices()
+	out.Indices = make([]uint32, len(m.Indices))
+	remap := make([]uint32, len(m.Vertices))
+	for i := range remap {
+		remap[i] = math.MaxUint32
+	}
+	for i, index := range m.Indices {
+		if remap[index] == math.MaxUint32 {
+			remap[index] = uint32(len(out.Vertices))
+			out.appendVertex(&m, index)
+		}
+		out.Indices[i] = remap[index]
+	}
+	return out
+}
+
+func optimizeVertexCache(m Mesh, subMeshes []SubMesh, objects []Object, opts VertexCacheOptions) Mesh {
+	if m.Indices == nil {
+		m = IndexMesh(m)
+	}
+	cacheSize := opts.CacheSize
+	if cacheSize <= 0 {
+		cacheSize = defaultVertexCacheSize
+	}
+	triangleCount := m.TriangleCount()
+
+	// Cut the triangles into runs no range starts or ends in
+	cuts := []int{0, triangleCount}
+	addRange := func(first, count int) {
+		cuts = append(cuts, min(first/3, triangleCount), min((first+count)/3, triangleCount))
+	}
+	for _, subMesh := range subMeshes {
+		addRange(subMesh.First, subMesh.Count)
+	}
+	for _, object := range objects {
+		addRange(object.First, object.Count)
+		for _, group := range object.Groups {
+			addRange(group.First, group.Count)
+		}
+	}
+	sort.Ints(cuts)
+
+	order := make([]int, 0, triangleCount)
+	for i := 1; i < len(cuts); i++ {
+		start, end := cuts[i-1], cuts[i]
+		if start == end {
+			continue
+		}
+		run := forsythOrder(&m, start, end, cacheSize)
+		if opts.OverdrawThreshold > 1 {
+			run = sortOverdraw(&m, run, cacheSize, opts.OverdrawThreshold)
+		}
+		order = append(order, run...)
+	}
+
+	out := m
+	out.Indices = make([]uint32, 0, len(m.Indices))
+	if m.Smoothing != nil {
+		out.Smoothing = make([]uint32, 0, len(m.Smoothing))
+	}
+	for _, t := range order {
+		a, b, c := m.Triangle(t)
+		out.Indices = append(out.Indices, a, b, c)
+		if m.Smoothing != nil {
+			out.Smoothing = append(out.Smoothing, m.Smoothing[t])
+		}
+	}
+	return out
+}
+
+// Scores of Forsyth's algorithm, from "Linear-Speed Vertex Cache
+// Optimisation"
+const (
+	forsythCacheDecayPower   = 1.5
+	forsythLastTriangleScore = 0.75
+	forsythValenceBoostScale = 2
+	forsythValenceBoostPower = 0.5
+)
+
+// forsythScore returns how good it is to draw a triangle using a vertex at
+// position in the cache, -1 if not cached, with remaining triangles still to
+// draw.
+func forsythScore(position, remaining, cacheSize int) float32 {
+	if remaining == 0 {
+		return -1
+	}
+	var score float64
+	if position >= 0 {
+		if position < 3 {
+			// Used by the last triangle, which is penalized a little so
+			// that strips don't go back and forth
+			score = forsythLastTriangleScore
+		} else {
+			score = math.Pow(1-float64(position-3)/float64(cacheSize-3), forsythCacheDecayPower)
+		}
+	}
+	// Finish off vertices with few triangles left so they leave the cache
+	score += forsythValenceBoostScale * math.Pow(float64(remaining), -forsythValenceBoostPower)
+	return float32(score)
+}
+
+// forsythOrder returns the triangles start to end of m in cache friendly
+// order, picking each time the triangle whose vertices score best. Like
+// Forsyth's, its scores rank vertices by how recently they were used, which
+// also suits the FIFO caches ACMR and sortOverdraw simulate.
+func forsythOrder(m *Mesh, start, end, cacheSize int) []int {
+	count := end - start
+	cacheSize = max(cacheSize, 4)
+
+	// Local numbering of the vertices of the run
+	local := make(map[uint32]int32)
+	corners := make([][3]int32, count)
+	for t := range corners {
+		a, b, c := m.Triangle(start + t)
+		for k, index := range [3]uint32{a, b, c} {
+			id, found := local[index]
+			if !found {
+				id = int32(len(local))
+				local[index] = id
+			}
+			corners[t][k] = id
+		}
+	}
+	vertexCount := len(local)
+
+	// Triangles of every vertex still to draw, in the range offsets[v] to
+	// offsets[v]+remaining[v] of adjacency
+	remaining := make([]int, vertexCount)
+	for _, corner := range corners {
+		for _, v := range corner {
+			remaining[v]++
+		}
+	}
+	offsets := make([]int, vertexCount+1)
+	for v := range remaining {
+		offsets[v+1] = offsets[v] + remaining[v]
+	}
+	adjacency := make([]int, offsets[vertexCount])
+	filled := make([]int, vertexCount)
+	for t, corner := range corners {
+		for _, v := range corner {
+			adjacency[offsets[v]+filled[v]] = t
+			filled[v]++
+		}
+	}
+
+	scores := make([]float32, vertexCount)
+	for v := range scores {
+		scores[v] = forsythScore(-1, remaining[v], cacheSize)
+	}
+	triangleScores := make([]float32, count)
+	best := 0
+	for t, corner := range corners {
+		triangleScores[t] = scores[corner[0]] + scores[corner[1]] + scores[corner[2]]
+		if triangleScores[t] > triangleScores[best] {
+			best = t
+		}
+	}
+
+	order := make([]int, 0, count)
+	drawn := make([]bool, count)
+	var cache, next []int32
+	cursor := 0
+	for len(order) < count {
+		if best < 0 {
+			// Nothing in the cache has triangles left, start somewhere else
+			for drawn[cursor] {
+				cursor++
+			}
+			best = cursor
+		}
+		t := best
+		order = append(order, start+t)
+		drawn[t] = true
+
+		// Move the vertices of t to the front of the cache
+		next = next[:0]
+		for _, v := range corners[t] {
+			// Remove t from the triangles of v
+			triangles := adjacency[offsets[v] : offsets[v]+remaining[v]]
+			for i, u := range triangles {
+				if u == t {
+					triangles[i] = triangles[len(triangles)-1]
+					break
+				}
+			}
+			remaining[v]--
+			// Degenerate triangles use a vertex more than once
+			if len(next) == 0 || next[len(next)-1] != v && next[0] != v {
+				next = append(next, v)
+			}
+		}
+		for _, v := range cache {
+			if v != corners[t][0] && v != corners[t][1] && v != corners[t][2] {
+				next = append(next, v)
+			}
+		}
+		for _, v := range next[min(len(next), cacheSize):] {
+			scores[v] = forsythScore(-1, remaining[v], cacheSize)
+		}
+		cache, next = next[:min(len(next), cacheSize)], cache
+
+		// Rescore what the move affected and pick the best triangle around
+		for i, v := range cache {
+			scores[v] = forsythScore(i, remaining[v], cacheSize)
+		}
+		best = -1
+		for _, v := range cache {
+			for _, u := range adjacency[offsets[v] : offsets[v]+remaining[v]] {
+				corner := corners[u]
+				triangleScores[u] = scores[corner[0]] + scores[corner[1]] + scores[corner[2]]
+				if best < 0 || triangleScores[u] > triangleScores[best] {
+					best = u
+				}
+			}
+		}
+	}
+	return order
+}
+
+// sortOverdraw splits triangles, already in cache friendly order, into
+// clusters and sorts them so that those facing away from the center of the
+// mesh are drawn first, following Sander, Nehab and Barczak's "Fast Triangle
+// Reordering for Vertex Locality and Reduced Overdraw". Clusters are cut
+// where the cache is flushed anyway, and where the ACMR of the cluster so
+// far stays within threshold of the ACMR of the whole run.
+func sortOverdraw(m *Mesh, triangles []int, cacheSize int, threshold float32) []int {
+	cache := newFIFOCache(len(m.Vertices), cacheSize)
+
+	// Hard boundaries, where a triangle reuses no vertex
+	var hard []int
+	for i, t := range triangles {
+		a, b, c := m.Triangle(t)
+		if cache.use(a, b, c) == 3 {
+			hard = append(hard, i)
+		}
+	}
+	hard = append(hard, len(triangles))
+
+	// Soft boundaries inside each hard cluster
+	var cuts []int
+	for i := 1; i < len(hard); i++ {
+		start, end := hard[i-1], hard[i]
+		cache.flush()
+		misses := 0
+		for _, t := range triangles[start:end] {
+			a, b, c := m.Triangle(t)
+			misses += cache.use(a, b, c)
+		}
+		limit := threshold * float32(misses) / float32(end-start)
+
+		cuts = append(cuts, start)
+		cache.flush()
+		clusterStart, misses := start, 0
+		for j := start; j < end-1; j++ {
+			a, b, c := m.Triangle(triangles[j])
+			misses += cache.use(a, b, c)
+			if float32(misses)/float32(j+1-clusterStart) <= limit {
+				cuts = append(cuts, j+1)
+				cache.flush()
+				clusterStart, misses = j+1, 0
+			}
+		}
+	}
+	cuts = append(cuts, len(triangles))
+
+	// Area weighted center and normal of every cluster
+	type cluster struct {
+		start, end int
+		score      float64
+	}
+	clusters := make([]cluster, len(cuts)-1)
+	centers := make([]mgl32.Vec3, len(clusters))
+	normals := make([]mgl32.Vec3, len(clusters))
+	var meshCenter mgl32.Vec3
+	var meshArea float32
+	for i := range clusters {
+		clusters[i] = cluster{start: cuts[i], end: cuts[i+1]}
+		var area float32
+		for _, t := range triangles[cuts[i]:cuts[i+1]] {
+			a, b, c := m.Triangle(t)
+			p0, p1, p2 := m.Vertices[a], m.Vertices[b], m.Vertices[c]
+			normal := p1.Sub(p0).Cross(p2.Sub(p0))
+			triangleArea := normal.Len()
+			normals[i] = normals[i].Add(normal)
+			centers[i] = centers[i].Add(p0.Add(p1).Add(p2).Mul(triangleArea / 3))
+			area += triangleArea
+		}
+		meshCenter = meshCenter.Add(centers[i])
+		meshArea += area
+		if area > 0 {
+			centers[i] = centers[i].Mul(1 / area)
+		}
+	}
+	if meshArea > 0 {
+		meshCenter = meshCenter.Mul(1 / meshArea)
+	}
+	for i := range clusters {
+		clusters[i].score = float64(centers[i].Sub(meshCenter).Dot(normalize(normals[i])))
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].score > clusters[j].score
+	})
+
+	sorted := make([]int, 0, len(triangles))
+	for _, c := range clusters {
+		sorted = append(sorted, triangles[c.start:c.end]...)
+	}
+	return sorted
+}
+
+// fifoCache simulates a post-transform vertex cache where vertices are
+// evicted in the order they were transformed.
+type fifoCache struct {
+	stamps []int // time each vertex was last transformed
+	time   int
+	size   int
+}
+
+func newFIFOCache(vertexCount, size int) *fifoCache {
+	if size <= 0 {
+		size = defaultVertexCacheSize
+	}
+	return &fifoCache{stamps: make([]int, vertexCount), time: size + 1, size: size}
+}
+
+// use returns how many of the vertices of a triangle had to be transformed.
+func (c *fifoCache) use(vertices ...uint32) int {
+	misses := 0
+	for _, v := range vertices {
+		if c.time-c.stamps[v] > c.size {
+			c.stamps[v] = c.time
+			c.time++
+			misses++
+		}
+	}
+	return misses
+}
+
+// flush empties the cache.
+func (c *fifoCache) flush() {
+	c.time += c.size + 1
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+// triangleSet counts the triangles of m by the vertices their corners refer
+// to, so that meshes can be compared whatever their order.
+func triangleSet(m Mesh) map[[3]packedVertex]int {
+	set := make(map[[3]packedVertex]int)
+	for t := 0; t < m.TriangleCount(); t++ {
+		a, b, c := m.Triangle(t)
+		set[[3]packedVertex{m.packVertex(a), m.packVertex(b), m.packVertex(c)}]++
+	}
+	return set
+}
+
+func TestOptimizeVertexCache(t *testing.T) {
+	m, err := LoadOBJFile(suzannePath, &OBJOptions{Index: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := ACMR(m, 0)
+	want := triangleSet(m)
+
+	for _, opts := range []VertexCacheOptions{{}, {CacheSize: 16}, {OverdrawThreshold: 1.05}} {
+		optimized := OptimizeVertexCache(m, opts)
+		after := ACMR(optimized, 0)
+		t.Logf("%+v: ACMR %.3f before and %.3f after", opts, before, after)
+		if after >= before {
+			t.Errorf("%+v: ACMR went from %.3f to %.3f", opts, before, after)
+		}
+		if !reflect.DeepEqual(triangleSet(optimized), want) {
+			t.Errorf("%+v: triangles changed", opts)
+		}
+
+		// Reordering the vertices keeps the triangles and the ACMR
+		fetched := OptimizeVertexFetch(optimized)
+		if !reflect.DeepEqual(triangleSet(fetched), want) {
+			t.Errorf("%+v: vertex fetch optimization changed the triangles", opts)
+		}
+		if acmr := ACMR(fetched, 0); acmr != after {
+			t.Errorf("%+v: vertex fetch optimization changed the ACMR from %.3f to %.3f", opts, after, acmr)
+		}
+		// Vertices come in the order the triangles first use them
+		next := uint32(0)
+		for _, index := range fetched.Indices {
+			if index > next {
+				t.Fatalf("%+v: vertex %d used before vertex %d", opts, index, next)
+			}
+			if index == next {
+				next++
+			}
+		}
+	}
+}
+
+func TestOptimizeModelVertexCache(t *testing.T) {
+	m, err := LoadOBJModel(suzannePath, &OBJOptions{Index: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Split the triangles into two objects at an odd place
+	half := 3 * (m.TriangleCount() / 2)
+	m.Objects = []Object{{Name: "a", First: 0, Count: half}, {Name: "b", First: half, Count: len(m.Indices) - half}}
+
+	optimized := OptimizeModelVertexCache(m, VertexCacheOptions{})
+	for _, object := range m.Objects {
+		part := func(m Model) Mesh {
+			mesh := m.Mesh
+			mesh.Indices = mesh.Indices[object.First : object.First+object.Count]
+			return mesh
+		}
+		if !reflect.DeepEqual(triangleSet(part(optimized)), triangleSet(part(m))) {
+			t.Errorf("object %s: triangles moved across objects", object.Name)
+		}
+	}
+	if before, after := ACMR(m.Mesh, 0), ACMR(optimized.Mesh, 0); after >= before {
+		t.Errorf("ACMR went from %.3f to %.3f", before, after)
+	}
+}
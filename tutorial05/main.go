@@ -68,9 +68,13 @@ func main() {
 	// Our ModelViewProjection : multiplication of our 3 matrices
 	MVP := projection.Mul4(view.Mul4(model))
 
-	// Load the texture using any two methods
-	//texture := common.LoadBMPCustom("uvtemplate.bmp")
-	texture := common.LoadDDS("uvtemplate.DDS")
+	// Load the texture using any of three methods
+	//texture, _ := common.LoadBMPCustom("uvtemplate.bmp")
+	//texture, _ := common.LoadTGA("uvtemplate.tga")
+	texture, err := common.LoadDDS("uvtemplate.DDS")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Get a handle for our "myTextureSampler" uniform
 	textureId := gl.GetUniformLocation(programId, gl.Str("myTextureSampler"+"\x00"))
@@ -69,7 +69,10 @@ func main() {
 	matrixId := gl.GetUniformLocation(programId, gl.Str("MVP"+"\x00"))
 
 	// Load the texture using any two methods
-	texture := common.LoadDDS("uvtemplate.DDS")
+	texture, err := common.LoadDDS("uvtemplate.DDS")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Get a handle for our "myTextureSampler" uniform
 	textureId := gl.GetUniformLocation(programId, gl.Str("myTextureSampler"+"\x00"))
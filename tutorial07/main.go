@@ -70,7 +70,10 @@ func main() {
 	matrixId := gl.GetUniformLocation(programId, gl.Str("MVP"+"\x00"))
 
 	// Load the texture using any two methods
-	texture := common.LoadDDS("uvmap.DDS")
+	texture, err := common.LoadDDS("uvmap.DDS")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Get a handle for our "myTextureSampler" uniform
 	textureId := gl.GetUniformLocation(programId, gl.Str("myTextureSampler"+"\x00"))
@@ -80,6 +83,9 @@ func main() {
 	var uvs []mgl32.Vec2
 	vertices, uvs, normals, _ = common.LoadOBJ("cube.obj", vertices, uvs, normals)
 
+	// Start with the whole model in view
+	common.FrameSphere(common.ComputeBoundingSphere(vertices))
+
 	// Load it into a VBO
 	var vertexBuffer uint32
 	gl.GenBuffers(1, &vertexBuffer)